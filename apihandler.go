@@ -1,9 +1,17 @@
 package sequence
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // write api handlers
@@ -14,16 +22,159 @@ import (
 // draw each sequence
 // save the image.
 
-func RegisterSequenceHandler(router *gin.Engine, aph *jwt.GinJWTMiddleware) {
-	u := GinSequenceHandler{}
+const API_PREFIX = "/api/v1"
 
-	router.POST("/api/v1/sequence/", u.Sequence)
+func RegisterSequenceHandler(router *gin.Engine, aph *jwt.GinJWTMiddleware) error {
+	return RegisterSequenceHandlerWithConfig(router, aph, DefaultHandlerConfig())
+}
+
+// HandlerConfig configures the sequence api.
+type HandlerConfig struct {
+	// rendering defaults applied to every request.
+	Render Config
+	// let requests without a token through even when a jwt middleware is given.
+	AllowAnonymous bool
+	// when set every rendered diagram is stored under the tenant of the request.
+	Store DiagramStore
+	// when set identical renders are served from the cache.
+	Cache *RenderCache
+	// how long clients may keep images that never change ( sources in the url, old revisions ).
+	MaxAge time.Duration
+	// diagrams going over them are refused with a 413 or 422.
+	Limits Limits
+	// renders taking longer fail with a 503, 0 for no timeout.
+	RenderTimeout time.Duration
+}
+
+func DefaultHandlerConfig() HandlerConfig {
+	return HandlerConfig{Render: DefaultConfig(), MaxAge: 24 * time.Hour, Limits: DefaultLimits(), RenderTimeout: 10 * time.Second}
+}
+
+// RegisterSequenceHandlerWithConfig adds the sequence api to router, it fails when cfg.Render is
+// invalid.
+func RegisterSequenceHandlerWithConfig(router *gin.Engine, aph *jwt.GinJWTMiddleware, cfg HandlerConfig) error {
+	renderer, err := NewRenderer(WithConfig(cfg.Render), WithLimits(cfg.Limits))
+	if err != nil {
+		return err
+	}
+	u := GinSequenceHandler{config: cfg, renderer: renderer, authenticated: aph != nil}
+	// live renders outlive the request that submitted them, the hub cancels them instead.
+	u.live = NewLiveHub(u.render)
+
+	api := router.Group(API_PREFIX)
+	if aph != nil {
+		RegisterAuthHandlers(api, aph)
+	}
+
+	sequence := api.Group("/sequence", AuthMiddleware(aph, cfg.AllowAnonymous))
+	sequence.POST("/", u.Sequence)
+	// static routes can't sit next to /:id, so /validate, /batch and /live/:session are
+	// dispatched by PostSub.
+	sequence.POST("/:id", u.PostSub)
+	sequence.POST("/:id/:sub", u.PostSub)
+	// /png/{encoded} and /live/:session share the wildcards with /:id/png, /:id/revisions and /:id/diff.
+	sequence.GET("/:id/:sub", u.GetDiagramSub)
+	if cfg.Store != nil {
+		sequence.GET("/:id", u.GetDiagram)
+		sequence.PUT("/:id", u.UpdateDiagram)
+		sequence.GET("/:id/:sub/:rev", u.GetRevision)
+		sequence.GET("/:id/:sub/:rev/:format", u.GetRevisionOutput)
+		sequence.POST("/:id/:sub/:rev", u.RollbackDiagram)
+	}
+	return nil
 }
 
 type GinSequenceHandler struct {
+	config HandlerConfig
+	// built once, requests derive the renderer of their format and options from it.
+	renderer *Renderer
+	live     *LiveHub
+	// tenants come from the tokens instead of the tenantID header.
+	authenticated bool
 }
 
 func (u *GinSequenceHandler) Sequence(c *gin.Context) {
+	tenantID := ""
+	if u.config.Store != nil {
+		t, ok := u.tenant(c)
+		if !ok {
+			return
+		}
+		tenantID = t
+	}
+	u.renderAndSave(c, tenantID, "")
+}
+
+// PostSub serves POST /sequence/validate, /sequence/batch and /sequence/live/:session.
+func (u *GinSequenceHandler) PostSub(c *gin.Context) {
+	switch path := c.Param("id"); {
+	case path == "validate" && len(c.Param("sub")) == 0:
+		u.Validate(c)
+	case path == "format" && len(c.Param("sub")) == 0:
+		u.Format(c)
+	case path == "batch" && len(c.Param("sub")) == 0:
+		u.Batch(c)
+	case path == "live" && len(c.Param("sub")) > 0:
+		u.LiveSubmit(c)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	}
+}
+
+// Validate parses the posted source and returns the participants, number of messages and
+// diagnostics as json, no image is drawn. An invalid source is still a 200, see "valid".
+func (u *GinSequenceHandler) Validate(c *gin.Context) {
+	source, err := requestSource(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := u.renderContext(c.Request.Context())
+	defer cancel()
+	result, err := ValidateContext(ctx, source, u.config.Render, u.config.Limits)
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Format returns the posted source pretty printed as text, ?align=true lines up the colons of
+// consecutive messages.
+func (u *GinSequenceHandler) Format(c *gin.Context) {
+	opts := FormatOptions{}
+	if s, ok := c.GetQuery("align"); ok {
+		align, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid align %q", s)})
+			return
+		}
+		opts.AlignColons = align
+	}
+	rawData, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(opts.Format(string(rawData))))
+}
+
+// UpdateDiagram renders the posted source and saves it as the next revision of a stored diagram.
+func (u *GinSequenceHandler) UpdateDiagram(c *gin.Context) {
+	d, ok := u.storedDiagram(c)
+	if !ok {
+		return
+	}
+	u.renderAndSave(c, d.TenantID, d.ID)
+}
+
+// renderAndSave renders the request body and, with a store, saves it as a revision of id ( a
+// new diagram when id is empty ).
+func (u *GinSequenceHandler) renderAndSave(c *gin.Context, tenantID string, id string) {
+	cfg, ok := u.negotiate(c)
+	if !ok {
+		return
+	}
 	rawData, err := c.GetRawData()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -38,11 +189,478 @@ func (u *GinSequenceHandler) Sequence(c *gin.Context) {
 	//}
 	//pprof.StartCPUProfile(f)
 	//defer pprof.StopCPUProfile()
-	responseBytes, err := CreateDiagram(fullText)
+	var responseBytes []byte
+	var warnings []Diagnostic
+	var key string
+	document := c.ContentType() == "application/json"
+	if document {
+		// documents are built as they are, their diagnostics point at json paths.
+		responseBytes, warnings, err = u.renderDocument(c.Request.Context(), rawData, cfg)
+		key = u.documentKey(rawData, cfg)
+	} else {
+		responseBytes, warnings, err = u.render(c.Request.Context(), fullText, cfg)
+		key = u.renderKey(fullText, cfg)
+	}
+	if err != nil {
+		renderError(c, http.StatusBadRequest, err)
+		return
+	}
+	if document && u.config.Store != nil {
+		// revisions are kept as source, so the texts of stored documents have to fit its syntax.
+		if fullText, err = SourceFromJSON(rawData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	SetWarningsHeader(c, warnings)
+	c.Header("ETag", etag(key))
+
+	if u.config.Store != nil {
+		stored := StoredDiagram{
+			ID:       id,
+			Author:   RequestAuthor(c),
+			Source:   fullText,
+			Outputs:  map[string][]byte{cfg.Format: responseBytes},
+			Warnings: warnings,
+		}
+		if !u.save(c, tenantID, &stored) {
+			return
+		}
+	}
+	c.Data(http.StatusOK, ContentType(cfg.Format), responseBytes)
+}
+
+// requestSource is the posted diagram source, a json Document when the Content-Type is
+// application/json is turned into source, so its texts have to fit the source syntax.
+func requestSource(c *gin.Context) (string, error) {
+	rawData, err := c.GetRawData()
+	if err != nil {
+		return "", err
+	}
+	if c.ContentType() == "application/json" {
+		return SourceFromJSON(rawData)
+	}
+	return string(rawData), nil
+}
+
+// negotiate picks the output format from ?format= or the Accept header, on failure a 406 is
+// already written.
+func (u *GinSequenceHandler) negotiate(c *gin.Context) (Config, bool) {
+	cfg := u.config.Render
+	c.Header("Vary", "Accept")
+	if format, ok := c.GetQuery("format"); ok {
+		if !IsSupportedFormat(format) {
+			notAcceptable(c, fmt.Sprintf("Unsupported format %s", format))
+			return cfg, false
+		}
+		cfg.Format = format
+		return cfg, true
+	}
+	format, ok := NegotiateFormat(c.GetHeader("Accept"), cfg.Format)
+	if !ok {
+		notAcceptable(c, fmt.Sprintf("None of the accepted types %s can be rendered", c.GetHeader("Accept")))
+		return cfg, false
+	}
+	cfg.Format = format
+	return cfg, true
+}
+
+func notAcceptable(c *gin.Context, message string) {
+	c.JSON(http.StatusNotAcceptable, gin.H{"error": message, "supported": SupportedFormats()})
+}
+
+// renderError writes a failed render as json, errors in the source come with their diagnostic.
+// Diagrams too large to render and renders that timed out replace status.
+func renderError(c *gin.Context, status int, err error) {
+	body := gin.H{"error": err.Error()}
+	switch e := err.(type) {
+	case Diagnostic:
+		body["diagnostics"] = []Diagnostic{e}
+	case LimitError:
+		body["limit"] = e
+		status = limitStatus(e)
+	}
+	if err == context.DeadlineExceeded {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, body)
+}
+
+// limitStatus is 413 for a source too large to read and 422 for a source that reads fine but
+// makes a diagram too large.
+func limitStatus(e LimitError) int {
+	switch e.Limit {
+	case LIMIT_SOURCE_BYTES, LIMIT_LINES:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// save stores d and points the response at it, on failure the response is already written.
+func (u *GinSequenceHandler) save(c *gin.Context, tenantID string, d *StoredDiagram) bool {
+	if err := u.config.Store.Save(tenantID, d); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	c.Header(HEADER_DIAGRAM_ID, d.ID)
+	c.Header(HEADER_REVISION, strconv.Itoa(d.Revision))
+	c.Header("Location", fmt.Sprintf("%s/sequence/%s", API_PREFIX, d.ID))
+	return true
+}
+
+// storeError writes the response for a failed store lookup.
+func storeError(c *gin.Context, err error) {
+	if err == ErrDiagramNotFound || err == ErrRevisionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// tenant is the tenant of the request, see RequestTenant, on failure the response is already
+// written.
+func (u *GinSequenceHandler) tenant(c *gin.Context) (string, bool) {
+	tenantID, err := RequestTenant(c, u.authenticated)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return tenantID, true
+}
+
+// storedDiagram loads the latest revision of the diagram named in the path for the tenant of
+// the request, on failure the response is already written.
+func (u *GinSequenceHandler) storedDiagram(c *gin.Context) (*StoredDiagram, bool) {
+	tenantID, ok := u.tenant(c)
+	if !ok {
+		return nil, false
+	}
+	d, err := u.config.Store.Get(tenantID, c.Param("id"))
+	if err != nil {
+		storeError(c, err)
+		return nil, false
+	}
+	return d, true
+}
+
+// storedRevision is storedDiagram for the revision numbered s.
+func (u *GinSequenceHandler) storedRevision(c *gin.Context, s string) (*StoredDiagram, bool) {
+	tenantID, ok := u.tenant(c)
+	if !ok {
+		return nil, false
+	}
+	revision, err := ParseRevision(s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	d, err := u.config.Store.GetRevision(tenantID, c.Param("id"), revision)
 	if err != nil {
+		storeError(c, err)
+		return nil, false
+	}
+	return d, true
+}
+
+// GetDiagram returns the stored source, outputs and warnings of the latest revision as json.
+func (u *GinSequenceHandler) GetDiagram(c *gin.Context) {
+	d, ok := u.storedDiagram(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
 
+// GetDiagramSub serves the source encoded in the url ( /sequence/png/{encoded} ), the live
+// preview stream ( /sequence/live/:session ) and, with a
+// store, /sequence/:id/revisions, /sequence/:id/diff and the image of the latest revision
+// ( /sequence/:id/png ). Stored ids never look like a format.
+func (u *GinSequenceHandler) GetDiagramSub(c *gin.Context) {
+	if IsSupportedFormat(c.Param("id")) {
+		u.RenderEncoded(c)
+		return
+	}
+	if c.Param("id") == "live" {
+		u.LiveStream(c)
+		return
+	}
+	if u.config.Store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	switch c.Param("sub") {
+	case "revisions":
+		u.ListRevisions(c)
+	case "diff":
+		u.DiffRevisions(c)
+	default:
+		u.GetDiagramOutput(c)
+	}
+}
+
+// RenderEncoded renders a source encoded with EncodeSource in the path so diagrams can be
+// embedded with a plain <img> tag.
+func (u *GinSequenceHandler) RenderEncoded(c *gin.Context) {
+	format := c.Param("id")
+	source, err := DecodeSource(c.Param("sub"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.Data(http.StatusOK, "image/png", responseBytes)
+	cfg := u.config.Render
+	cfg.Format = format
+	// the url is the source, the image behind it never changes, errors aren't cached.
+	cacheControl := u.maxAge("public")
+	if notModified(c, u.renderKey(source, cfg), cacheControl) {
+		return
+	}
+	data, warnings, err := u.render(c.Request.Context(), source, cfg)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, err)
+		return
+	}
+	SetWarningsHeader(c, warnings)
+	c.Header("Cache-Control", cacheControl)
+	c.Data(http.StatusOK, ContentType(format), data)
+}
+
+// GetDiagramOutput returns the image of the latest revision of a stored diagram.
+func (u *GinSequenceHandler) GetDiagramOutput(c *gin.Context) {
+	format := c.Param("sub")
+	if !IsSupportedFormat(format) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unsupported format %s", format)})
+		return
+	}
+	d, ok := u.storedDiagram(c)
+	if !ok {
+		return
+	}
+	// the latest revision changes, clients have to check back.
+	u.writeOutput(c, d, format, "private, no-cache")
+}
+
+// writeOutput sends d in format, formats that were not stored are rendered from the source.
+// cacheControl is only sent with the output, not with errors.
+func (u *GinSequenceHandler) writeOutput(c *gin.Context, d *StoredDiagram, format string, cacheControl string) {
+	c.Header(HEADER_REVISION, strconv.Itoa(d.Revision))
+	data, found := d.Outputs[format]
+	if found {
+		sum := sha256.Sum256(data)
+		if notModified(c, hex.EncodeToString(sum[:]), cacheControl) {
+			return
+		}
+	} else {
+		cfg := u.config.Render
+		cfg.Format = format
+		if notModified(c, u.renderKey(d.Source, cfg), cacheControl) {
+			return
+		}
+		out, _, err := u.render(c.Request.Context(), d.Source, cfg)
+		if err != nil {
+			renderError(c, http.StatusInternalServerError, err)
+			return
+		}
+		data = out
+	}
+	SetWarningsHeader(c, d.Warnings)
+	c.Header("Cache-Control", cacheControl)
+	c.Data(http.StatusOK, ContentType(format), data)
+}
+
+// ListRevisions returns the author and time of every revision, oldest first.
+func (u *GinSequenceHandler) ListRevisions(c *gin.Context) {
+	tenantID, ok := u.tenant(c)
+	if !ok {
+		return
+	}
+	revisions, err := u.config.Store.Revisions(tenantID, c.Param("id"))
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// GetRevision returns one revision as json ( /sequence/:id/revisions/3 ).
+func (u *GinSequenceHandler) GetRevision(c *gin.Context) {
+	if c.Param("sub") != "revisions" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	d, ok := u.storedRevision(c, c.Param("rev"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// GetRevisionOutput returns the image of one revision ( /sequence/:id/revisions/3/png ).
+func (u *GinSequenceHandler) GetRevisionOutput(c *gin.Context) {
+	format := c.Param("format")
+	if c.Param("sub") != "revisions" || !IsSupportedFormat(format) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unsupported format %s", format)})
+		return
+	}
+	d, ok := u.storedRevision(c, c.Param("rev"))
+	if !ok {
+		return
+	}
+	u.writeOutput(c, d, format, u.maxAge("private"))
+}
+
+// RollbackDiagram saves an old revision again as the latest one ( POST /sequence/:id/rollback/3 ),
+// the history in between is kept.
+func (u *GinSequenceHandler) RollbackDiagram(c *gin.Context) {
+	if c.Param("sub") != "rollback" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	d, ok := u.storedRevision(c, c.Param("rev"))
+	if !ok {
+		return
+	}
+	rollback := StoredDiagram{
+		ID:       d.ID,
+		Author:   RequestAuthor(c),
+		Source:   d.Source,
+		Outputs:  d.Outputs,
+		Warnings: d.Warnings,
+	}
+	if !u.save(c, d.TenantID, &rollback) {
+		return
+	}
+	c.JSON(http.StatusOK, rollback.Info())
+}
+
+// DiffRevisions compares the sources of two revisions ( /sequence/:id/diff?from=1&to=3 ), by
+// default the latest revision against the one before it.
+func (u *GinSequenceHandler) DiffRevisions(c *gin.Context) {
+	latest, ok := u.storedDiagram(c)
+	if !ok {
+		return
+	}
+	to := latest
+	if s, found := c.GetQuery("to"); found {
+		if to, ok = u.storedRevision(c, s); !ok {
+			return
+		}
+	}
+	from := to
+	if s, found := c.GetQuery("from"); found {
+		if from, ok = u.storedRevision(c, s); !ok {
+			return
+		}
+	} else if to.Revision > 1 {
+		if from, ok = u.storedRevision(c, strconv.Itoa(to.Revision-1)); !ok {
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from.Info(),
+		"to":    to.Info(),
+		"lines": DiffLines(from.Source, to.Source),
+	})
+}
+
+// render goes through the cache when there is one, within the limits and timeout of the
+// handler.
+func (u *GinSequenceHandler) render(ctx context.Context, source string, cfg Config) ([]byte, []Diagnostic, error) {
+	ctx, cancel := u.renderContext(ctx)
+	defer cancel()
+	renderer, err := u.renderer.With(WithConfig(cfg))
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.config.Cache == nil {
+		return renderer.RenderContext(ctx, source)
+	}
+	r, err := u.config.Cache.RenderContext(ctx, renderer, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Data, r.Warnings, nil
+}
+
+// renderDocument is render for a json Document.
+func (u *GinSequenceHandler) renderDocument(ctx context.Context, data []byte, cfg Config) ([]byte, []Diagnostic, error) {
+	ctx, cancel := u.renderContext(ctx)
+	defer cancel()
+	renderer, err := u.renderer.With(WithConfig(cfg))
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.config.Cache == nil {
+		return renderer.RenderDocumentContext(ctx, data)
+	}
+	r, err := u.config.Cache.RenderDocumentContext(ctx, renderer, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Data, r.Warnings, nil
+}
+
+// renderKey is the Key of source for the renderer cfg is rendered with, the ETag of the output.
+func (u *GinSequenceHandler) renderKey(source string, cfg Config) string {
+	r := *u.renderer
+	r.config = cfg
+	return r.Key(source)
+}
+
+// documentKey is renderKey for a json Document.
+func (u *GinSequenceHandler) documentKey(data []byte, cfg Config) string {
+	r := *u.renderer
+	r.config = cfg
+	return r.DocumentKey(data)
+}
+
+// renderContext bounds ctx by the render timeout.
+func (u *GinSequenceHandler) renderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if u.config.RenderTimeout > 0 {
+		return context.WithTimeout(ctx, u.config.RenderTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (u *GinSequenceHandler) maxAge(scope string) string {
+	return fmt.Sprintf("%s, max-age=%d", scope, int(u.config.MaxAge.Seconds()))
+}
+
+func etag(key string) string {
+	return `"` + key + `"`
+}
+
+// notModified sets the ETag of the response and answers 304, with cacheControl, when the client
+// already has it.
+func notModified(c *gin.Context, key string, cacheControl string) bool {
+	tag := etag(key)
+	c.Header("ETag", tag)
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			c.Header("Cache-Control", cacheControl)
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// HEADER_WARNINGS carries the parse warnings as a json array since the body is the image itself.
+const HEADER_WARNINGS = "X-Sequence-Warnings"
+
+// HEADER_DIAGRAM_ID is the id a rendered diagram was stored under.
+const HEADER_DIAGRAM_ID = "X-Sequence-Id"
+
+// HEADER_REVISION is the revision of the stored diagram that was saved or served.
+const HEADER_REVISION = "X-Sequence-Revision"
+
+func SetWarningsHeader(c *gin.Context, warnings []Diagnostic) {
+	if len(warnings) == 0 {
+		return
+	}
+	data, err := json.Marshal(warnings)
+	if err != nil {
+		return
+	}
+	c.Header(HEADER_WARNINGS, string(data))
 }
@@ -0,0 +1,728 @@
+package sequence
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testAuthMiddleware() *jwt.GinJWTMiddleware {
+	return &jwt.GinJWTMiddleware{
+		Realm:      "test",
+		Key:        []byte("local test signing key"),
+		MaxRefresh: time.Hour,
+		Authenticator: func(c *gin.Context) (interface{}, error) {
+			var login struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			}
+			if err := c.ShouldBindJSON(&login); err != nil || login.Password != "secret" {
+				return nil, jwt.ErrFailedAuthentication
+			}
+			return login.Username, nil
+		},
+		PayloadFunc: func(data interface{}) jwt.MapClaims {
+			return jwt.MapClaims{"id": data, TENANT_CLAIM: testTenants[fmt.Sprint(data)]}
+		},
+	}
+}
+
+// testTenants are the tenants of the users of testAuthMiddleware, nobody has none.
+var testTenants = map[string]string{"alice": "tenant1", "bob": "tenant1", "carol": "tenant2"}
+
+func testToken(aph *jwt.GinJWTMiddleware, user string) map[string]string {
+	token, _, err := aph.TokenGenerator(user, user)
+	if err != nil {
+		panic(err)
+	}
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+func testRouter(aph *jwt.GinJWTMiddleware, cfg HandlerConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := RegisterSequenceHandlerWithConfig(router, aph, cfg); err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func TestRegisterInvalidRenderConfig(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Render.Format = "bmp"
+	assert.EqualError(t, RegisterSequenceHandlerWithConfig(gin.New(), nil, cfg), "Unsupported format bmp")
+}
+
+func doRequest(router *gin.Engine, method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSequenceHandlerWithoutAuth(t *testing.T) {
+	router := testRouter(nil, DefaultHandlerConfig())
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A ->+ B: hello", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	var warnings []Diagnostic
+	assert.NoError(t, json.Unmarshal([]byte(w.Header().Get(HEADER_WARNINGS)), &warnings))
+	assert.Len(t, warnings, 1)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/auth/login", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "no login route without a middleware")
+}
+
+func TestSequenceHandlerRequiresToken(t *testing.T) {
+	aph := testAuthMiddleware()
+	router := testRouter(aph, DefaultHandlerConfig())
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/auth/login", `{"username": "alice", "password": "wrong"}`,
+		map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/auth/login", `{"username": "alice", "password": "secret"}`,
+		map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var login struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.NotEmpty(t, login.Token)
+
+	bearer := map[string]string{"Authorization": fmt.Sprintf("Bearer %s", login.Token)}
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/auth/refresh", "", bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/auth/refresh", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Authorization": "Bearer nonsense"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	aph := testAuthMiddleware()
+	aph.Timeout = time.Minute
+	router := testRouter(aph, DefaultHandlerConfig())
+
+	aph.TimeFunc = func() time.Time { return time.Now().Add(-10 * time.Minute) }
+	expired, _, err := aph.TokenGenerator("alice", "alice")
+	assert.NoError(t, err)
+	aph.TimeFunc = time.Now
+
+	bearer := map[string]string{"Authorization": "Bearer " + expired}
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", bearer)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/auth/refresh", "", bearer)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// the signature is still checked.
+	forged := expired[:len(expired)-4] + "AAAA"
+	w = doRequest(router, http.MethodGet, "/api/v1/auth/refresh", "", map[string]string{"Authorization": "Bearer " + forged})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshConcurrently(t *testing.T) {
+	aph := testAuthMiddleware()
+	router := testRouter(aph, DefaultHandlerConfig())
+	token, _, err := aph.TokenGenerator("alice", "alice")
+	assert.NoError(t, err)
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	// the middleware is set up once, requests only read it ( go test -race ).
+	wg := sync.WaitGroup{}
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				codes[i] = doRequest(router, http.MethodGet, "/api/v1/auth/refresh", "", bearer).Code
+			} else {
+				codes[i] = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hi", bearer).Code
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+}
+
+func TestSequenceHandlerAllowAnonymous(t *testing.T) {
+	aph := testAuthMiddleware()
+	cfg := DefaultHandlerConfig()
+	cfg.AllowAnonymous = true
+	router := testRouter(aph, cfg)
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a token that is sent still has to be valid.
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Authorization": "Bearer nonsense"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token, _, err := aph.TokenGenerator("bob", nil)
+	assert.NoError(t, err)
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Authorization": "Bearer " + token})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSequenceHandlerStoresPerTenant(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Store = NewMemoryStore()
+	router := testRouter(nil, cfg)
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "tenant is required with a store")
+
+	tenant1 := map[string]string{"tenantID": "tenant1"}
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := w.Header().Get(HEADER_DIAGRAM_ID)
+	assert.NotEmpty(t, id)
+	assert.Equal(t, "/api/v1/sequence/"+id, w.Header().Get("Location"))
+	image := w.Body.Bytes()
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stored StoredDiagram
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, "A -> B: hello", stored.Source)
+	assert.Equal(t, image, stored.Outputs[FORMAT_PNG])
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/png", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, image, w.Body.Bytes())
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/svg", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/bmp", "", tenant1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// another tenant can't read it.
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", map[string]string{"tenantID": "tenant2"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/png", "", map[string]string{"tenantID": "tenant2"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSequenceHandlerTenantFromToken(t *testing.T) {
+	aph := testAuthMiddleware()
+	cfg := DefaultHandlerConfig()
+	cfg.Store = NewMemoryStore()
+	cfg.AllowAnonymous = true
+	router := testRouter(aph, cfg)
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", testToken(aph, "bob"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := w.Header().Get(HEADER_DIAGRAM_ID)
+
+	// alice shares the tenant of bob, carol doesn't.
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", testToken(aph, "alice"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", testToken(aph, "carol"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// with authentication the tenant comes from the token, not from the header.
+	carol := testToken(aph, "carol")
+	carol["tenantID"] = "tenant1"
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", carol)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", map[string]string{"tenantID": "tenant1"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id, "", testToken(aph, "nobody"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSequenceHandlerRevisions(t *testing.T) {
+	aph := testAuthMiddleware()
+	cfg := DefaultHandlerConfig()
+	cfg.Store = NewMemoryStore()
+	cfg.AllowAnonymous = true
+	router := testRouter(aph, cfg)
+
+	tenant1 := testToken(aph, "bob")
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(HEADER_REVISION))
+	id := w.Header().Get(HEADER_DIAGRAM_ID)
+	first := w.Body.Bytes()
+
+	w = doRequest(router, http.MethodPut, "/api/v1/sequence/"+id, "A -> B: hello\nB -> C: again", testToken(aph, "alice"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(HEADER_REVISION))
+	assert.Equal(t, id, w.Header().Get(HEADER_DIAGRAM_ID))
+
+	w = doRequest(router, http.MethodPut, "/api/v1/sequence/missing", "A -> B: hello", tenant1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodPut, "/api/v1/sequence/"+id, "A -> B: hello", testToken(aph, "carol"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Revisions []RevisionInfo `json:"revisions"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Revisions, 2) {
+		assert.Equal(t, "bob", list.Revisions[0].Author)
+		assert.Equal(t, "alice", list.Revisions[1].Author)
+		assert.False(t, list.Revisions[1].Created.IsZero())
+	}
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/1", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stored StoredDiagram
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, "A -> B: hello", stored.Source)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/1/png", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, first, w.Body.Bytes())
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/9", "", tenant1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/latest", "", tenant1)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/diff", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff struct {
+		From  RevisionInfo `json:"from"`
+		To    RevisionInfo `json:"to"`
+		Lines []DiffLine   `json:"lines"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 1, diff.From.Revision)
+	assert.Equal(t, 2, diff.To.Revision)
+	assert.Equal(t, []DiffLine{{Op: DIFF_EQUAL, Text: "A -> B: hello"}, {Op: DIFF_INSERT, Text: "B -> C: again"}}, diff.Lines)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/"+id+"/rollback/1", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get(HEADER_REVISION))
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/png", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get(HEADER_REVISION))
+	assert.Equal(t, first, w.Body.Bytes())
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/diff?from=2&to=3", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, []DiffLine{{Op: DIFF_EQUAL, Text: "A -> B: hello"}, {Op: DIFF_DELETE, Text: "B -> C: again"}}, diff.Lines)
+}
+
+func TestSequenceHandlerEncodedSource(t *testing.T) {
+	encoded, err := EncodeSource("A -> B: hello")
+	assert.NoError(t, err)
+
+	for _, cfg := range []HandlerConfig{DefaultHandlerConfig(), {Render: DefaultConfig(), Store: NewMemoryStore()}} {
+		router := testRouter(nil, cfg)
+		w := doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+encoded, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("Cache-Control"))
+
+		w = doRequest(router, http.MethodGet, "/api/v1/sequence/svg/"+encoded, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "<svg")
+
+		w = doRequest(router, http.MethodGet, "/api/v1/sequence/png/garbage!", "", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	invalid, err := EncodeSource("A -> B: hello\nthis is not valid")
+	assert.NoError(t, err)
+	router := testRouter(nil, DefaultHandlerConfig())
+	w := doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+invalid, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/bmp/"+encoded, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// the route is guarded like the others.
+	router = testRouter(testAuthMiddleware(), DefaultHandlerConfig())
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+encoded, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSequenceHandlerCaching(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Cache = NewRenderCache(1<<20, time.Hour)
+	cfg.Store = NewMemoryStore()
+	router := testRouter(nil, cfg)
+	encoded, err := EncodeSource("A -> B: hello")
+	assert.NoError(t, err)
+
+	w := doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+encoded, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	tag := w.Header().Get("ETag")
+	assert.NotEmpty(t, tag)
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+	assert.Equal(t, 1, cfg.Cache.Len())
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+encoded, "", map[string]string{"If-None-Match": tag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+	assert.Equal(t, "public, max-age=86400", w.Header().Get("Cache-Control"))
+
+	// errors aren't cached, the limits or the server may change.
+	invalid, err := EncodeSource("A -> B: hello\nnot a statement")
+	assert.NoError(t, err)
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/png/"+invalid, "", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/svg/"+encoded, "", map[string]string{"If-None-Match": tag})
+	assert.Equal(t, http.StatusOK, w.Code, "other format, other tag")
+
+	// posting the same source is served from the cache.
+	tenant1 := map[string]string{"tenantID": "tenant1"}
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, tag, w.Header().Get("ETag"))
+	assert.Equal(t, 2, cfg.Cache.Len())
+	id := w.Header().Get(HEADER_DIAGRAM_ID)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/png", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	stored := w.Header().Get("ETag")
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/png", "", map[string]string{"tenantID": "tenant1", "If-None-Match": "W/" + stored})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/1/svg", "", tenant1)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, max-age=86400", w.Header().Get("Cache-Control"))
+	w = doRequest(router, http.MethodGet, "/api/v1/sequence/"+id+"/revisions/1/svg", "",
+		map[string]string{"tenantID": "tenant1", "If-None-Match": `"other", ` + w.Header().Get("ETag")})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestSequenceHandlerContentNegotiation(t *testing.T) {
+	router := testRouter(nil, DefaultHandlerConfig())
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/?format=svg", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Accept": "image/gif;q=0.5, image/jpeg"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Accept": "text/html, */*;q=0.8"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Accept": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var layout DiagramLayout
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &layout))
+	assert.Len(t, layout.Participants, 2)
+
+	// the query wins over the header.
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/?format=gif", "A -> B: hello", map[string]string{"Accept": "image/svg+xml"})
+	assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/?format=pdf", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Accept": "text/plain"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "|--hello->|")
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/?format=tiff", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	var notAcceptable struct {
+		Supported []string `json:"supported"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notAcceptable))
+	assert.Equal(t, SupportedFormats(), notAcceptable.Supported)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello", map[string]string{"Accept": "application/xml, video/*"})
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: hello\nthis is not valid", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var failed struct {
+		Error       string       `json:"error"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+	if assert.Len(t, failed.Diagnostics, 1) {
+		assert.Equal(t, SEVERITY_ERROR, failed.Diagnostics[0].Severity)
+		assert.Equal(t, 2, failed.Diagnostics[0].Line)
+	}
+}
+
+func TestSequenceHandlerValidate(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Store = NewMemoryStore()
+	router := testRouter(nil, cfg)
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/validate", "A ->+ B: hello\nB --> C: ok\n== done ==", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var result ValidationResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Valid)
+	assert.Equal(t, []string{"A", "B", "C"}, result.Participants)
+	assert.Equal(t, 2, result.Messages)
+	if assert.Len(t, result.Diagnostics, 1) {
+		assert.Equal(t, SEVERITY_WARNING, result.Diagnostics[0].Severity)
+		assert.Equal(t, 1, result.Diagnostics[0].Line)
+	}
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/validate", "A -> B: hello\n  this is not valid", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	result = ValidationResult{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Equal(t, []string{"A", "B"}, result.Participants)
+	if assert.Len(t, result.Diagnostics, 1) {
+		assert.Equal(t, Diagnostic{Severity: SEVERITY_ERROR, Line: 2, Column: 3, Message: result.Diagnostics[0].Message}, result.Diagnostics[0])
+	}
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/other", "A -> B: hello", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSequenceHandlerDocument(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Store = NewMemoryStore()
+	router := testRouter(nil, cfg)
+	doc := `{"version": 1, "participants": [{"name": "A"}, {"name": "B"}],
+		"elements": [{"type": "message", "from": "A", "to": "B", "text": "hello", "activation": "activate"}]}`
+	jsonBody := map[string]string{"Content-Type": "application/json", "tenantID": "tenant1"}
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/?format=svg", doc, jsonBody)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	w = doRequest(router, http.MethodGet, w.Header().Get("Location"), "", jsonBody)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stored StoredDiagram
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, "participant A\nparticipant B\nA ->+ B: hello\n", stored.Source)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/validate", doc, jsonBody)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"messages":1`)
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", `{"version": 3}`, jsonBody)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Unsupported document version")
+
+	// the diagnostics of documents point at the element.
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/",
+		`{"version": 1, "participants": [{"name": "A"}, {"name": " "}], "elements": []}`, jsonBody)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var failed struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &failed))
+	if assert.Len(t, failed.Diagnostics, 1) {
+		assert.Equal(t, "participants[1]", failed.Diagnostics[0].Path)
+		assert.Equal(t, 0, failed.Diagnostics[0].Line)
+	}
+
+	// texts outside of the source syntax render, but can't be stored as source.
+	free := `{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "text": "GET /x"}]}`
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", free, jsonBody)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "doesn't fit the source syntax")
+	router = testRouter(nil, DefaultHandlerConfig())
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/?format=svg", free, jsonBody)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "GET /x")
+	// a source and a document never share an ETag.
+	r, err := NewRenderer()
+	assert.NoError(t, err)
+	assert.NotEqual(t, r.Key(free), r.DocumentKey([]byte(free)))
+}
+
+func TestSequenceHandlerFormat(t *testing.T) {
+	router := testRouter(nil, DefaultHandlerConfig())
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/format", "A->B:hello\nalt ok\nBob-->A : done\nend", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "A -> B: hello\nalt ok\n  Bob --> A: done\nend\n", w.Body.String())
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/format?align=true", "A->B:hello\nBob-->A : done", nil)
+	assert.Equal(t, "A -> B   : hello\nBob --> A: done\n", w.Body.String())
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/format?align=maybe", "A->B:hello", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func readZip(t *testing.T, data []byte) map[string][]byte {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	files := make(map[string][]byte)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		files[f.Name], err = ioutil.ReadAll(rc)
+		assert.NoError(t, err)
+		rc.Close()
+	}
+	return files
+}
+
+func TestSequenceHandlerBatch(t *testing.T) {
+	router := testRouter(nil, DefaultHandlerConfig())
+
+	body := `{"options": {"format": "svg"}, "items": [
+		{"name": "login", "source": "A -> B: hello"},
+		{"name": "docs/logout", "source": "A ->+ B: bye", "options": {"format": "png"}},
+		{"name": "broken", "source": "A -> B: hello\nnot valid"},
+		{"name": "../escape", "source": "A -> B: hello"},
+		{"name": "login", "source": "A -> B: again"}
+	]}`
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/batch", body, map[string]string{"Content-Type": "application/json"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, "3", w.Header().Get(HEADER_BATCH_FAILURES))
+
+	files := readZip(t, w.Body.Bytes())
+	assert.Contains(t, string(files["login.svg"]), "<svg")
+	assert.True(t, bytes.HasPrefix(files["docs/logout.png"], []byte("\x89PNG")))
+	assert.Len(t, files, 3)
+
+	var report struct {
+		Results []BatchResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(files[BATCH_REPORT], &report))
+	if assert.Len(t, report.Results, 5) {
+		assert.Equal(t, "login.svg", report.Results[0].File)
+		assert.Len(t, report.Results[1].Diagnostics, 1, "unbalanced activation warning")
+		assert.NotEmpty(t, report.Results[2].Error)
+		assert.Equal(t, 2, report.Results[2].Diagnostics[0].Line)
+		assert.NotEmpty(t, report.Results[3].Error)
+		assert.Contains(t, report.Results[4].Error, "Duplicate")
+	}
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/batch", `{"items": []}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/batch", `{"options": {"format": "bmp"}, "items": [{"name": "a", "source": "A -> B: hi"}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSequenceHandlerBatchZip(t *testing.T) {
+	router := testRouter(nil, DefaultHandlerConfig())
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, src := range map[string]string{"flows/login.seq": "A -> B: hello", "logout.seq": "A -> B: bye"} {
+		f, err := zw.Create(name)
+		assert.NoError(t, err)
+		f.Write([]byte(src))
+	}
+	assert.NoError(t, zw.Close())
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/batch?format=gif", buf.String(), map[string]string{"Content-Type": "application/zip"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get(HEADER_BATCH_FAILURES))
+	files := readZip(t, w.Body.Bytes())
+	assert.True(t, bytes.HasPrefix(files["flows/login.gif"], []byte("GIF8")))
+	assert.True(t, bytes.HasPrefix(files["logout.gif"], []byte("GIF8")))
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/batch", "not a zip", map[string]string{"Content-Type": "application/zip"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func batchZip(t *testing.T, count int, size int) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	src := strings.Repeat("#", size)
+	for i := 0; i < count; i++ {
+		f, err := zw.Create(fmt.Sprintf("d%d.seq", i))
+		assert.NoError(t, err)
+		f.Write([]byte(src))
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadBatchZipLimits(t *testing.T) {
+	_, err := readBatchZip(batchZip(t, MAX_BATCH_ITEMS+1, 0))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "larger than 1000")
+	}
+
+	// every entry is under its own cap, together they are too much.
+	_, err = readBatchZip(batchZip(t, MAX_BATCH_ZIP_BYTES/MAX_DECODED_SOURCE_BYTES+1, MAX_DECODED_SOURCE_BYTES))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Zip sources are larger")
+	}
+
+	items, err := readBatchZip(batchZip(t, 2, 10))
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+}
+
+func TestBatchNameReport(t *testing.T) {
+	for _, name := range []string{"report", "./report", "REPORT"} {
+		_, err := batchName(name)
+		assert.Error(t, err, name)
+	}
+	name, err := batchName("docs/report")
+	assert.NoError(t, err)
+	assert.Equal(t, "docs/report", name)
+}
+
+func TestSequenceHandlerLimits(t *testing.T) {
+	cfg := DefaultHandlerConfig()
+	cfg.Limits = Limits{MaxLines: 3, MaxParticipants: 2}
+	router := testRouter(nil, cfg)
+
+	w := doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: a\nB -> A: b\nA -> B: c\nB -> A: d", nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"error": "Sequence has more than 3 lines", "limit": {"limit": "lines", "max": 3}}`, w.Body.String())
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/", "A -> B: a\nB -> C: b", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"error": "line 2: More than 2 participants", "limit": {"limit": "participants", "max": 2, "line": 2}}`, w.Body.String())
+
+	w = doRequest(router, http.MethodPost, "/api/v1/sequence/validate", "A -> B: a\nB -> C: b", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "validation reports limits as diagnostics")
+	assert.Contains(t, w.Body.String(), "More than 2 participants")
+
+	// a request whose time is already up.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	for _, path := range []string{"/api/v1/sequence/", "/api/v1/sequence/validate"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader("A -> B: a")).WithContext(ctx))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+	}
+}
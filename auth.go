@@ -0,0 +1,171 @@
+package sequence
+
+import (
+	"fmt"
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"go-sequencediagrams/utils"
+	jwtgo "gopkg.in/dgrijalva/jwt-go.v3"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// AuthMiddleware guards the sequence routes with aph. With allowAnonymous requests without a
+// token are let through, a token that is sent still has to be valid.
+func AuthMiddleware(aph *jwt.GinJWTMiddleware, allowAnonymous bool) gin.HandlerFunc {
+	if aph == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	authenticate := aph.MiddlewareFunc()
+	if !allowAnonymous {
+		return authenticate
+	}
+	return func(c *gin.Context) {
+		if !HasToken(c, aph) {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// HasToken checks if the request carries a token where aph looks for it ( TokenLookup ).
+func HasToken(c *gin.Context, aph *jwt.GinJWTMiddleware) bool {
+	kind, name := tokenLookup(aph)
+	switch kind {
+	case "header":
+		return len(c.GetHeader(name)) > 0
+	case "query":
+		return len(c.Query(name)) > 0
+	case "cookie":
+		cookie, err := c.Cookie(name)
+		return err == nil && len(cookie) > 0
+	}
+	return false
+}
+
+// tokenLookup splits the TokenLookup of aph into where and under which name the token is.
+func tokenLookup(aph *jwt.GinJWTMiddleware) (string, string) {
+	lookup := aph.TokenLookup
+	if len(lookup) == 0 {
+		lookup = "header:Authorization"
+	}
+	parts := strings.SplitN(strings.TrimSpace(lookup), ":", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// requestToken is the token of the request, without the TokenHeadName of a header.
+func requestToken(c *gin.Context, aph *jwt.GinJWTMiddleware) string {
+	kind, name := tokenLookup(aph)
+	switch kind {
+	case "header":
+		header := strings.SplitN(c.GetHeader(name), " ", 2)
+		if len(header) == 2 && header[0] == aph.TokenHeadName {
+			return header[1]
+		}
+	case "query":
+		return c.Query(name)
+	case "cookie":
+		cookie, _ := c.Cookie(name)
+		return cookie
+	}
+	return ""
+}
+
+// RegisterAuthHandlers adds the login and refresh routes of aph to api.
+func RegisterAuthHandlers(api *gin.RouterGroup, aph *jwt.GinJWTMiddleware) {
+	auth := api.Group("/auth")
+	auth.POST("/login", aph.LoginHandler)
+	// the middleware would refuse the expired tokens RefreshHandler renews within MaxRefresh.
+	auth.GET("/refresh", refreshableToken(aph), aph.RefreshHandler)
+}
+
+// refreshableToken lets requests with a token of aph through, expired or not. The refresh
+// handler of gin-jwt doesn't check the signature of the token it renews.
+func refreshableToken(aph *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	// the defaults of aph are filled in once, requests only read them.
+	if err := aph.MiddlewareInit(); err != nil {
+		return func(c *gin.Context) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+	return func(c *gin.Context) {
+		token, err := jwtgo.Parse(requestToken(c, aph), func(t *jwtgo.Token) (interface{}, error) {
+			if jwtgo.GetSigningMethod(aph.SigningAlgorithm) != t.Method {
+				return nil, jwt.ErrInvalidSigningAlgorithm
+			}
+			return verificationKey(aph)
+		})
+		if ve, ok := err.(*jwtgo.ValidationError); ok && ve.Errors == jwtgo.ValidationErrorExpired {
+			err = nil
+		}
+		if err == nil {
+			if _, ok := token.Claims.(jwtgo.MapClaims)["orig_iat"].(float64); !ok {
+				err = jwt.ErrExpiredToken
+			}
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", "JWT realm="+aph.Realm)
+			c.Abort()
+			aph.Unauthorized(c, http.StatusUnauthorized, aph.HTTPStatusMessageFunc(err, c))
+			return
+		}
+		c.Next()
+	}
+}
+
+// verificationKey is the key tokens of aph are signed with, or the public key of RS algorithms.
+func verificationKey(aph *jwt.GinJWTMiddleware) (interface{}, error) {
+	switch aph.SigningAlgorithm {
+	case "RS256", "RS384", "RS512":
+		data, err := ioutil.ReadFile(aph.PubKeyFile)
+		if err != nil {
+			return nil, jwt.ErrNoPubKeyFile
+		}
+		return jwtgo.ParseRSAPublicKeyFromPEM(data)
+	}
+	return aph.Key, nil
+}
+
+// TENANT_CLAIM is the claim of a token that names the tenant of its requests.
+const TENANT_CLAIM = "tenant"
+
+// ANONYMOUS_TENANT is the tenant of requests without a token when authentication is on.
+const ANONYMOUS_TENANT = "anonymous"
+
+// RequestTenant is the tenant of the request. With authentication it comes from the tenant claim
+// of the token, which the client can't change, and requests without a token share
+// ANONYMOUS_TENANT. Only without authentication the client names it in the tenantID header.
+func RequestTenant(c *gin.Context, authenticated bool) (string, error) {
+	if !authenticated {
+		return utils.GetTenantID(c)
+	}
+	payload, ok := c.Get("JWT_PAYLOAD")
+	if !ok {
+		return ANONYMOUS_TENANT, nil
+	}
+	claims, _ := payload.(jwtgo.MapClaims)
+	tenant, _ := claims[TENANT_CLAIM].(string)
+	if len(tenant) == 0 {
+		return "", fmt.Errorf("Token has no %s claim", TENANT_CLAIM)
+	}
+	return tenant, nil
+}
+
+// ANONYMOUS_AUTHOR is recorded as the author of revisions saved without a token.
+const ANONYMOUS_AUTHOR = "anonymous"
+
+// RequestAuthor is the identity of the token the request was authenticated with.
+func RequestAuthor(c *gin.Context) string {
+	id, ok := c.Get("userID")
+	if !ok || id == nil {
+		return ANONYMOUS_AUTHOR
+	}
+	return fmt.Sprint(id)
+}
@@ -0,0 +1,269 @@
+package sequence
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MAX_BATCH_ITEMS caps the number of diagrams in one batch request.
+const MAX_BATCH_ITEMS = 1000
+
+// MAX_BATCH_ZIP_BYTES caps the sources of a zip upload together, each entry is also capped by
+// MAX_DECODED_SOURCE_BYTES.
+const MAX_BATCH_ZIP_BYTES = 16 << 20
+
+// HEADER_BATCH_FAILURES is the number of items of a batch that could not be rendered.
+const HEADER_BATCH_FAILURES = "X-Sequence-Batch-Failures"
+
+// BATCH_REPORT is the name of the per item report in the returned zip.
+const BATCH_REPORT = "report.json"
+
+// BatchRequest is the json body of POST /sequence/batch. Options are a partial Config applied
+// over the server defaults, the options of an item over those of the request.
+type BatchRequest struct {
+	Options json.RawMessage `json:"options"`
+	Items   []BatchItem     `json:"items"`
+}
+
+type BatchItem struct {
+	Name    string          `json:"name"`
+	Source  string          `json:"source"`
+	Options json.RawMessage `json:"options"`
+}
+
+// BatchResult reports how one item went, File is its name in the zip.
+type BatchResult struct {
+	Name        string       `json:"name"`
+	File        string       `json:"file,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+
+	data []byte
+}
+
+// applyOptions returns cfg with the options set in the json object raw.
+func applyOptions(cfg Config, raw json.RawMessage) (Config, error) {
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("Invalid options: %s", err.Error())
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// batchName cleans an item name, it becomes a path inside the returned zip. The name of the
+// report is reserved, whatever the format of the item.
+func batchName(name string) (string, error) {
+	cleaned := path.Clean(strings.Replace(name, "\\", "/", -1))
+	if len(name) == 0 || cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Invalid name %q", name)
+	}
+	if strings.EqualFold(cleaned, strings.TrimSuffix(BATCH_REPORT, path.Ext(BATCH_REPORT))) {
+		return "", fmt.Errorf("Name %q is reserved for the report", name)
+	}
+	return cleaned, nil
+}
+
+// readBatchZip turns every file of a zip upload into an item named after the file without
+// its extension. The entries are counted before any is inflated and the sizes read, not the
+// ones the zip claims, are capped.
+func readBatchZip(data []byte) ([]BatchItem, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid zip: %s", err.Error())
+	}
+	var files []*zip.File
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+	if len(files) > MAX_BATCH_ITEMS {
+		return nil, fmt.Errorf("Batch of %d items is larger than %d", len(files), MAX_BATCH_ITEMS)
+	}
+
+	var items []BatchItem
+	total := 0
+	for _, f := range files {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid zip entry %s: %s", f.Name, err.Error())
+		}
+		src, err := ioutil.ReadAll(io.LimitReader(rc, MAX_DECODED_SOURCE_BYTES+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid zip entry %s: %s", f.Name, err.Error())
+		}
+		if len(src) > MAX_DECODED_SOURCE_BYTES {
+			return nil, fmt.Errorf("Zip entry %s is larger than %d bytes", f.Name, MAX_DECODED_SOURCE_BYTES)
+		}
+		if total += len(src); total > MAX_BATCH_ZIP_BYTES {
+			return nil, fmt.Errorf("Zip sources are larger than %d bytes", MAX_BATCH_ZIP_BYTES)
+		}
+		items = append(items, BatchItem{Name: strings.TrimSuffix(f.Name, path.Ext(f.Name)), Source: string(src)})
+	}
+	return items, nil
+}
+
+// readBatch reads a json BatchRequest or, with Content-Type application/zip, a zip of sources
+// rendered with the ?format= of the request.
+func (u *GinSequenceHandler) readBatch(c *gin.Context) (Config, []BatchItem, error) {
+	cfg := u.config.Render
+	rawData, err := c.GetRawData()
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	var items []BatchItem
+	if c.ContentType() == "application/zip" {
+		if format, ok := c.GetQuery("format"); ok {
+			cfg.Format = format
+		}
+		if err := cfg.Validate(); err != nil {
+			return cfg, nil, err
+		}
+		if items, err = readBatchZip(rawData); err != nil {
+			return cfg, nil, err
+		}
+	} else {
+		var req BatchRequest
+		if err := json.Unmarshal(rawData, &req); err != nil {
+			return cfg, nil, fmt.Errorf("Invalid batch request: %s", err.Error())
+		}
+		if cfg, err = applyOptions(cfg, req.Options); err != nil {
+			return cfg, nil, err
+		}
+		items = req.Items
+	}
+
+	if len(items) == 0 {
+		return cfg, nil, fmt.Errorf("Empty batch")
+	}
+	if len(items) > MAX_BATCH_ITEMS {
+		return cfg, nil, fmt.Errorf("Batch of %d items is larger than %d", len(items), MAX_BATCH_ITEMS)
+	}
+	return cfg, items, nil
+}
+
+// renderBatch renders the items on a worker per cpu, results keep the order of the items.
+func (u *GinSequenceHandler) renderBatch(ctx context.Context, cfg Config, items []BatchItem) []BatchResult {
+	results := make([]BatchResult, len(items))
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = u.renderBatchItem(ctx, cfg, items[i])
+			}
+		}()
+	}
+	for i := range items {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	// later items with a name already taken fail rather than overwrite.
+	files := make(map[string]bool)
+	for i := range results {
+		r := &results[i]
+		if len(r.File) == 0 {
+			continue
+		}
+		if files[r.File] {
+			r.Error = fmt.Sprintf("Duplicate name %q", r.Name)
+			r.File = ""
+			r.data = nil
+			continue
+		}
+		files[r.File] = true
+	}
+	return results
+}
+
+func (u *GinSequenceHandler) renderBatchItem(ctx context.Context, cfg Config, item BatchItem) BatchResult {
+	result := BatchResult{Name: item.Name, Diagnostics: []Diagnostic{}}
+	name, err := batchName(item.Name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	cfg, err = applyOptions(cfg, item.Options)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	data, warnings, err := u.render(ctx, item.Source, cfg)
+	if err != nil {
+		result.Error = err.Error()
+		if dg, ok := err.(Diagnostic); ok {
+			result.Diagnostics = append(result.Diagnostics, dg)
+		}
+		return result
+	}
+	result.Diagnostics = append(result.Diagnostics, warnings...)
+	result.File = name + "." + cfg.Format
+	result.data = data
+	return result
+}
+
+// Batch renders many diagrams in one request ( POST /sequence/batch ) and returns a zip of the
+// images with a report.json of how every item went. Items that fail don't fail the request.
+func (u *GinSequenceHandler) Batch(c *gin.Context) {
+	cfg, items, err := u.readBatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results := u.renderBatch(c.Request.Context(), cfg, items)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	failures := 0
+	for _, r := range results {
+		if len(r.File) == 0 {
+			failures++
+			continue
+		}
+		w, err := zw.Create(r.File)
+		if err == nil {
+			_, err = w.Write(r.data)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	report, err := json.MarshalIndent(gin.H{"results": results}, "", "  ")
+	if err == nil {
+		var w io.Writer
+		if w, err = zw.Create(BATCH_REPORT); err == nil {
+			_, err = w.Write(report)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header(HEADER_BATCH_FAILURES, strconv.Itoa(failures))
+	c.Header("Content-Disposition", `attachment; filename="diagrams.zip"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
@@ -0,0 +1,90 @@
+package sequence
+
+import (
+	"go-sequencediagrams/utils"
+	"image/color"
+)
+
+// Box groups the lifelines of a system boundary ( box "Backend" #lightblue ... end box ).
+type Box struct {
+	name string
+	// nil for the BoxFill of the theme.
+	fill         color.Color
+	participants []*Participant
+	position     utils.Rectangle
+	line         int
+}
+
+func (b *Box) Name() string {
+	return b.name
+}
+
+func (b *Box) Position() utils.Rectangle {
+	return b.position
+}
+
+func (b *Box) AddParticipant(p *Participant) {
+	p.box = b
+	b.participants = append(b.participants, p)
+}
+
+// ArrangeBoxedParticipants moves the participants of a box next to each other, the box takes
+// the place of its first participant.
+func (d *Diagram) ArrangeBoxedParticipants() {
+	if len(d.boxes) == 0 {
+		return
+	}
+	placed := make(map[*Participant]bool)
+	var ordered []*Participant
+	for _, p := range d.participants {
+		if placed[p] {
+			continue
+		}
+		members := []*Participant{p}
+		if p.box != nil {
+			members = p.box.participants
+		}
+		for _, m := range members {
+			placed[m] = true
+			ordered = append(ordered, m)
+		}
+	}
+	d.participants = ordered
+	for idx, p := range d.participants {
+		d.participantMap[p.name] = idx
+	}
+}
+
+func (d *Diagram) PlaceBoxes() {
+	for _, b := range d.boxes {
+		if len(b.participants) == 0 {
+			continue
+		}
+		first := b.participants[0].position
+		last := b.participants[len(b.participants)-1].position
+		b.position = utils.Rect(first.Min.X-CONFIG_BOX_PADDING, CONFIG_BOX_PADDING/2,
+			last.Max.X+CONFIG_BOX_PADDING, d.sequenceEndY+d.participantHeight+CONFIG_BOX_PADDING/2)
+	}
+}
+
+func (d *Diagram) RenderBox(dc Canvas, b *Box) {
+	if len(b.participants) == 0 {
+		return
+	}
+	dc.Push()
+	defer dc.Pop()
+	r := b.position
+	dc.DrawRectangle(float64(r.Min.X), float64(r.Min.Y), float64(r.Dx()), float64(r.Dy()))
+	if b.fill != nil {
+		dc.SetColor(b.fill)
+	} else {
+		dc.SetColor(d.theme.BoxFill)
+	}
+	dc.FillPreserve()
+	dc.SetColor(d.theme.BoxLine)
+	dc.Stroke()
+
+	dc.SetFontFace(d.SequenceFont)
+	dc.SetColor(d.theme.BoxText)
+	dc.DrawStringAnchored(b.name, float64(r.MidX()), float64(r.Min.Y+d.headerHeight)/2, 0.5, 0.5)
+}
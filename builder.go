@@ -0,0 +1,225 @@
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Builder constructs a diagram from code instead of source text:
+//
+//	b := sequence.NewBuilder()
+//	b.Participant("API").Link("https://docs.example.com/api")
+//	b.Message("Client", "API", "GET /x").Activate()
+//	b.Alt("found", func(b *sequence.Builder) {
+//		b.Message("API", "Client", "200 OK").Dotted().Deactivate()
+//	})
+//	d, err := b.Build()
+//
+// The statements go through the same steps as parsed ones, texts are used as they are so they
+// don't need to fit the source syntax. Diagnostics refer to the (1 based) number of the
+// statement, group ends count as statements.
+type Builder struct {
+	statements []*builderStatement
+}
+
+type builderStatement struct {
+	typ  int
+	data map[string]interface{}
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) add(typ int, data map[string]interface{}) *builderStatement {
+	st := &builderStatement{typ: typ, data: data}
+	b.statements = append(b.statements, st)
+	return st
+}
+
+// BuilderParticipant is a declared participant, declarations fix the order of participants.
+type BuilderParticipant struct {
+	statement *builderStatement
+}
+
+// Link makes the participant link to url.
+func (bp *BuilderParticipant) Link(url string) *BuilderParticipant {
+	bp.statement.data["link"] = url
+	return bp
+}
+
+// Participant declares a participant, the ones only used by messages appear in order of use.
+func (b *Builder) Participant(name string) *BuilderParticipant {
+	return &BuilderParticipant{statement: b.add(ST_PARTICIPANT, map[string]interface{}{"name": name})}
+}
+
+// BuilderMessage is a message, solid and without activation until changed.
+type BuilderMessage struct {
+	statement *builderStatement
+	dotted    bool
+	// 1 activates the receiver, -1 deactivates the sender.
+	activation int
+}
+
+// Message adds a solid message from one participant to another.
+func (b *Builder) Message(from string, to string, text string) *BuilderMessage {
+	return &BuilderMessage{statement: b.add(ST_SOLID, map[string]interface{}{"src": from, "dest": to, "text": text})}
+}
+
+func (m *BuilderMessage) update() *BuilderMessage {
+	types := map[bool][3]int{
+		false: {ST_END_PROCESS, ST_SOLID, ST_START_PROCESS},
+		true:  {ST_END_DOTTED_PROCESS, ST_DOTTED, ST_START_DOTTED_PROCESS},
+	}
+	m.statement.typ = types[m.dotted][m.activation+1]
+	return m
+}
+
+// Dotted draws the message as a dotted line, like a reply.
+func (m *BuilderMessage) Dotted() *BuilderMessage {
+	m.dotted = true
+	return m.update()
+}
+
+// Activate starts an activation on the receiver ( ->+ ).
+func (m *BuilderMessage) Activate() *BuilderMessage {
+	m.activation = 1
+	return m.update()
+}
+
+// Deactivate ends the activation of the sender ( ->- ).
+func (m *BuilderMessage) Deactivate() *BuilderMessage {
+	m.activation = -1
+	return m.update()
+}
+
+// Link makes the message link to url.
+func (m *BuilderMessage) Link(url string) *BuilderMessage {
+	m.statement.data["link"] = url
+	return m
+}
+
+func (b *Builder) group(name string, text string, body func(b *Builder)) *Builder {
+	b.add(ST_GROUP_MESSAGE, map[string]interface{}{"name": name, "text": text})
+	if body != nil {
+		body(b)
+	}
+	b.add(ST_END_GROUP, map[string]interface{}{})
+	return b
+}
+
+// Alt frames what body adds as an alternative, the group ends when body returns.
+func (b *Builder) Alt(text string, body func(b *Builder)) *Builder {
+	return b.group("alt", text, body)
+}
+
+// Loop frames what body adds as a loop, the group ends when body returns.
+func (b *Builder) Loop(text string, body func(b *Builder)) *Builder {
+	return b.group("loop", text, body)
+}
+
+// Box draws a box named name around the participants, color is a color name or #rrggbb and
+// can be empty for the default fill.
+func (b *Builder) Box(name string, color string, participants ...string) *Builder {
+	b.add(ST_BOX_START, map[string]interface{}{"text": name, "color": color})
+	for _, p := range participants {
+		b.Participant(p)
+	}
+	b.add(ST_BOX_END, map[string]interface{}{})
+	return b
+}
+
+// BuilderRef is an interaction use over participants.
+type BuilderRef struct {
+	statement *builderStatement
+}
+
+// Target names the diagram the ref points at.
+func (r *BuilderRef) Target(name string) *BuilderRef {
+	r.statement.data["target"] = name
+	return r
+}
+
+// Ref adds a ref box over the participants.
+func (b *Builder) Ref(text string, participants ...string) *BuilderRef {
+	src := make([]interface{}, 0, len(participants))
+	for _, p := range participants {
+		src = append(src, p)
+	}
+	return &BuilderRef{statement: b.add(ST_REF, map[string]interface{}{"src": src, "text": text, "target": ""})}
+}
+
+// Delay breaks the lifelines, text can be empty.
+func (b *Builder) Delay(text string) *Builder {
+	b.add(ST_DELAY, map[string]interface{}{"text": text})
+	return b
+}
+
+// Divider draws a line across the diagram, text can be empty.
+func (b *Builder) Divider(text string) *Builder {
+	b.add(ST_DIVIDER, map[string]interface{}{"text": text})
+	return b
+}
+
+// Space leaves height pixels of room.
+func (b *Builder) Space(height int) *Builder {
+	b.add(ST_SPACE, map[string]interface{}{"text": "", "height": float64(height)})
+	return b
+}
+
+// Build returns the diagram with the default config, like NewDiagram and Parse would.
+func (b *Builder) Build() (*Diagram, error) {
+	return b.BuildWithConfig(DefaultConfig())
+}
+
+func (b *Builder) BuildWithConfig(cfg Config) (*Diagram, error) {
+	if len(b.statements) == 0 {
+		return nil, fmt.Errorf("Empty sequence")
+	}
+	d, err := NewDiagramWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	st := &parseState{}
+	for i, s := range b.statements {
+		// statements are copied, the builder can be built again.
+		data := make(map[string]interface{}, len(s.data))
+		for k, v := range s.data {
+			data[k] = v
+		}
+		if err := checkStatement(s.typ, data); err != nil {
+			return nil, d.errorAt(i+1, err)
+		}
+		if err := d.addStatement(st, data, s.typ, i+1); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.endStatements(st); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkStatement refuses what the source syntax could never produce.
+func checkStatement(typ int, data map[string]interface{}) error {
+	names := []interface{}{data["src"], data["dest"]}
+	switch typ {
+	case ST_PARTICIPANT:
+		names = []interface{}{data["name"]}
+	case ST_REF:
+		names = data["src"].([]interface{})
+		if len(names) == 0 {
+			return fmt.Errorf("ref needs at least one participant")
+		}
+	case ST_SPACE:
+		if data["height"].(float64) < 0 {
+			return fmt.Errorf("Negative space height %v", data["height"])
+		}
+	}
+	for _, n := range names {
+		if name, ok := n.(string); ok && len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf("Empty participant name")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package sequence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder()
+	b.Box("Backend", "#ddeeff", "API", "DB")
+	b.Participant("Client").Link("https://docs.example.com/client")
+	b.Message("Client", "API", "get").Activate().Link("/code/api.go")
+	b.Alt("found", func(b *Builder) {
+		b.Message("API", "DB", "select").Activate()
+		b.Message("DB", "API", "row").Dotted().Deactivate()
+	})
+	b.Loop("retry", func(b *Builder) {
+		b.Message("Client", "Client", "wait")
+	})
+	b.Ref("auth flow", "Client", "API").Target("auth")
+	b.Delay("later").Divider("phase 2").Space(20)
+	b.Message("API", "Client", "200 OK").Dotted().Deactivate()
+	d, err := b.Build()
+	assert.NoError(t, err)
+	assert.Empty(t, d.Warnings())
+
+	parsed := mustParse(t, `box "Backend" #ddeeff
+  participant API
+  participant DB
+end box
+participant Client [[https://docs.example.com/client]]
+Client ->+ API: get [[/code/api.go]]
+alt found
+  API ->+ DB: select
+  DB -->- API: row
+end
+loop retry
+  Client -> Client: wait
+end
+ref over Client, API: auth flow [[auth]]
+... later ...
+== phase 2 ==
+||20||
+API -->- Client: 200 OK
+`)
+	assert.Equal(t, parsed.Document(), d.Document())
+
+	assert.NoError(t, d.Layout())
+	assert.NoError(t, parsed.Layout())
+	assert.Equal(t, parsed.LayoutInfo(), d.LayoutInfo())
+
+	again, err := b.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, d.Document(), again.Document(), "building doesn't change the builder")
+}
+
+func TestBuilderTexts(t *testing.T) {
+	b := NewBuilder()
+	b.Message("Web: Client", "API -> v2", "GET /x: \"quoted\" [[not a link]]")
+	d, err := b.Build()
+	assert.NoError(t, err)
+	if assert.Len(t, d.sequences, 1) {
+		s := d.sequences[0]
+		assert.Equal(t, "Web: Client", s.PrimaryParticipant().name)
+		assert.Equal(t, "API -> v2", s.SecondaryParticipant().name)
+		assert.Equal(t, "GET /x: \"quoted\" [[not a link]]", s.Text())
+	}
+	assert.NoError(t, d.Layout())
+	_, err = d.Encode(FORMAT_SVG)
+	assert.NoError(t, err)
+}
+
+func TestBuilderErrors(t *testing.T) {
+	_, err := NewBuilder().Build()
+	assert.EqualError(t, err, "Empty sequence")
+
+	b := NewBuilder()
+	b.Message("A", "B", "hi")
+	b.Message("A", "", "hi")
+	_, err = b.Build()
+	if assert.IsType(t, Diagnostic{}, err) {
+		assert.Equal(t, 2, err.(Diagnostic).Line)
+		assert.Equal(t, "Empty participant name", err.(Diagnostic).Message)
+	}
+
+	b = NewBuilder()
+	b.Ref("nothing")
+	_, err = b.Build()
+	assert.Error(t, err)
+
+	b = NewBuilder()
+	b.Message("A", "B", "hi").Link("javascript:alert(1)")
+	b.Message("B", "A", "bye").Deactivate()
+	d, err := b.Build()
+	assert.NoError(t, err)
+	if assert.Len(t, d.Warnings(), 2) {
+		assert.Equal(t, 1, d.Warnings()[0].Line)
+		assert.Equal(t, 2, d.Warnings()[1].Line)
+	}
+	assert.Empty(t, sequenceLink(d.sequences[0]))
+}
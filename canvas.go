@@ -0,0 +1,39 @@
+package sequence
+
+import (
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"image/color"
+)
+
+// Canvas is what the diagram is drawn on. *gg.Context satisfies it for the raster formats,
+// SVGCanvas records the same calls as svg elements.
+type Canvas interface {
+	Width() int
+	Height() int
+	Push()
+	Pop()
+
+	SetColor(c color.Color)
+	SetRGB(r, g, b float64)
+	SetDash(dashes ...float64)
+	SetFontFace(fontFace font.Face)
+
+	MeasureString(s string) (w, h float64)
+	WordWrap(s string, w float64) []string
+
+	MoveTo(x, y float64)
+	LineTo(x, y float64)
+	ClosePath()
+	DrawLine(x1, y1, x2, y2 float64)
+	DrawRectangle(x, y, w, h float64)
+	DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64)
+	Stroke()
+	Fill()
+	FillPreserve()
+
+	DrawStringAnchored(s string, x, y, ax, ay float64)
+	DrawStringWrapped(s string, x, y, ax, ay, width, lineSpacing float64, align gg.Align)
+}
+
+var _ Canvas = (*gg.Context)(nil)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-sequencediagrams"
+	"io"
+	"strings"
+)
+
+// runEncode prints the url encoded form of each source, with -url the full rendering url.
+func runEncode(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("encode", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("url", "", "server address, prints http://host/api/v1/sequence/<format>/<encoded>")
+	format := fs.String("f", sequence.FORMAT_PNG, fmt.Sprintf("format used in the url %v", sequence.SupportedFormats()))
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if !sequence.IsSupportedFormat(*format) {
+		fmt.Fprintf(stderr, "seqdiag: unsupported format %s\n", *format)
+		return EXIT_USAGE
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{STDIO}
+	}
+	for _, input := range inputs {
+		_, src, err := readSource(input, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+			return EXIT_INVALID
+		}
+		encoded, err := sequence.EncodeSource(src)
+		if err != nil {
+			fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+			return EXIT_INVALID
+		}
+		if len(*server) > 0 {
+			encoded = fmt.Sprintf("%s%s/sequence/%s/%s", strings.TrimSuffix(*server, "/"), sequence.API_PREFIX, *format, encoded)
+		}
+		fmt.Fprintln(stdout, encoded)
+	}
+	return EXIT_OK
+}
+
+// runDecode prints the source of an encoded diagram, the last path segment of a url is used.
+func runDecode(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: seqdiag decode <encoded|url>")
+		return EXIT_USAGE
+	}
+	encoded := args[0]
+	if i := strings.LastIndex(encoded, "/"); i >= 0 {
+		encoded = encoded[i+1:]
+	}
+	src, err := sequence.DecodeSource(encoded)
+	if err != nil {
+		fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+		return EXIT_INVALID
+	}
+	fmt.Fprint(stdout, src)
+	return EXIT_OK
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go-sequencediagrams"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DIFF_CONTEXT is the number of unchanged lines around the changes printed by fmt -d.
+const DIFF_CONTEXT = 3
+
+// runFmt formats sources like gofmt: the result is printed, or with -l the names of the files
+// that change, -w writes them back and -d prints a diff.
+func runFmt(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	write := fs.Bool("w", false, "write the result to the source file")
+	diff := fs.Bool("d", false, "print diffs instead of the result")
+	align := fs.Bool("align", false, "line up the colons of consecutive messages")
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "seqdiag: -w can't be used with stdin")
+			return EXIT_USAGE
+		}
+		inputs = []string{STDIO}
+	}
+
+	opts := sequence.FormatOptions{AlignColons: *align}
+	status := EXIT_OK
+	for _, input := range inputs {
+		name, src, err := readSource(input, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+			status = EXIT_INVALID
+			continue
+		}
+		formatted := opts.Format(src)
+		changed := formatted != src
+
+		if *list && changed {
+			fmt.Fprintln(stdout, name)
+		}
+		if *write && changed {
+			info, err := os.Stat(input)
+			if err == nil {
+				err = ioutil.WriteFile(input, []byte(formatted), info.Mode())
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+				status = EXIT_INVALID
+				continue
+			}
+		}
+		if *diff && changed {
+			io.WriteString(stdout, unifiedDiff(name, src, formatted))
+		}
+		if !*list && !*write && !*diff {
+			io.WriteString(stdout, formatted)
+		}
+	}
+	return status
+}
+
+// unifiedDiff prints the changes from a to b with DIFF_CONTEXT lines of context.
+func unifiedDiff(name string, a string, b string) string {
+	lines := sequence.DiffLines(a, b)
+	// the line of a and of b at each diff line, counting from 1.
+	aLine := make([]int, len(lines)+1)
+	bLine := make([]int, len(lines)+1)
+	aLine[0], bLine[0] = 1, 1
+	var changes []int
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.Op != sequence.DIFF_INSERT {
+			aLine[i+1]++
+		}
+		if l.Op != sequence.DIFF_DELETE {
+			bLine[i+1]++
+		}
+		if l.Op != sequence.DIFF_EQUAL {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n+++ %s (formatted)\n", name, name)
+	for c := 0; c < len(changes); {
+		start := changes[c] - DIFF_CONTEXT
+		if start < 0 {
+			start = 0
+		}
+		// changes closer than twice the context share a hunk.
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*DIFF_CONTEXT {
+			last++
+		}
+		end := changes[last] + DIFF_CONTEXT + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aLine[start], aLine[end]-aLine[start], bLine[start], bLine[end]-bLine[start])
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case sequence.DIFF_INSERT:
+				buf.WriteString("+")
+			case sequence.DIFF_DELETE:
+				buf.WriteString("-")
+			default:
+				buf.WriteString(" ")
+			}
+			buf.WriteString(l.Text + "\n")
+		}
+		c = last + 1
+	}
+	return buf.String()
+}
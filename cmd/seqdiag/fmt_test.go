@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFmtStdin(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := run([]string{"fmt"}, strings.NewReader("A->B:hello\nalt ok\nB-->A : done\nend"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.Equal(t, "A -> B: hello\nalt ok\n  B --> A: done\nend\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"fmt", "-align"}, strings.NewReader("A->B:hello\nBob-->A : done\n"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.Equal(t, "A -> B   : hello\nBob --> A: done\n", stdout.String())
+
+	code = run([]string{"fmt", "-w"}, strings.NewReader("A->B:hello"), new(bytes.Buffer), new(bytes.Buffer))
+	assert.Equal(t, EXIT_USAGE, code)
+}
+
+func TestFmtFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seqdiag")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clean := filepath.Join(dir, "clean.seq")
+	messy := filepath.Join(dir, "messy.seq")
+	assert.NoError(t, ioutil.WriteFile(clean, []byte("A -> B: hello\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(messy, []byte("participant A\nA->B:hello\nB -> A: ok\n"), 0644))
+
+	stdout := new(bytes.Buffer)
+	code := run([]string{"fmt", "-l", clean, messy}, nil, stdout, new(bytes.Buffer))
+	assert.Equal(t, EXIT_OK, code)
+	assert.Equal(t, messy+"\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"fmt", "-d", clean, messy}, nil, stdout, new(bytes.Buffer))
+	assert.Equal(t, EXIT_OK, code)
+	assert.Equal(t, "--- "+messy+"\n+++ "+messy+" (formatted)\n@@ -1,3 +1,3 @@\n participant A\n-A->B:hello\n+A -> B: hello\n B -> A: ok\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"fmt", "-w", clean, messy}, nil, stdout, new(bytes.Buffer))
+	assert.Equal(t, EXIT_OK, code)
+	assert.Empty(t, stdout.String())
+	data, err := ioutil.ReadFile(messy)
+	assert.NoError(t, err)
+	assert.Equal(t, "participant A\nA -> B: hello\nB -> A: ok\n", string(data))
+
+	code = run([]string{"fmt", filepath.Join(dir, "missing.seq")}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.Equal(t, EXIT_INVALID, code)
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"
+	assert.Equal(t, "--- x\n+++ x (formatted)\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n", unifiedDiff("x", a, b))
+	assert.Equal(t, "", unifiedDiff("x", a, a))
+}
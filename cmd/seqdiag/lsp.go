@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go-sequencediagrams"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// json-rpc error codes used by the language server.
+const (
+	RPC_PARSE_ERROR      = -32700
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+)
+
+// lsp constants, see the language server protocol specification.
+const (
+	LSP_SEVERITY_ERROR      = 1
+	LSP_SEVERITY_WARNING    = 2
+	LSP_SYNC_FULL           = 1
+	LSP_COMPLETION_VARIABLE = 6
+	LSP_COMPLETION_KEYWORD  = 14
+)
+
+// LSP_MAX_MESSAGE_BYTES caps the Content-Length of a message, the body is allocated up front.
+const LSP_MAX_MESSAGE_BYTES = 16 << 20
+
+// lspKeywords are offered by completion next to the participant names, notes aren't drawn so
+// they aren't offered.
+var lspKeywords = []string{
+	"participant", "alt", "else", "loop", "end", "ref over", "box", "end box", "...", "== ==", "|||",
+}
+
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspHover struct {
+	Contents lspMarkup `json:"contents"`
+	Range    lspRange  `json:"range"`
+}
+
+type lspMarkup struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type textDocumentParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Position lspPosition `json:"position"`
+}
+
+// lspServer speaks the language server protocol over a reader and writer, documents are
+// synced in full on every change.
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]string
+	shutdown  bool
+}
+
+func runLSP(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, "usage: seqdiag lsp ( talks the language server protocol on stdin and stdout )")
+		return EXIT_USAGE
+	}
+	s := &lspServer{in: bufio.NewReader(stdin), out: stdout, documents: make(map[string]string)}
+	if err := s.serve(); err != nil {
+		fmt.Fprintf(stderr, "seqdiag: lsp %s\n", err.Error())
+		return EXIT_INVALID
+	}
+	return EXIT_OK
+}
+
+// serve handles messages until exit or the end of the input.
+func (s *lspServer) serve() error {
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.write(rpcMessage{Error: &rpcError{Code: RPC_PARSE_ERROR, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		result, rpcErr := s.handle(msg)
+		// notifications don't get a response.
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.write(rpcMessage{ID: msg.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+}
+
+// read returns the body of the next message, framed by a Content-Length header.
+func (s *lspServer) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > LSP_MAX_MESSAGE_BYTES {
+		return nil, fmt.Errorf("Content-Length %d is larger than %d", length, LSP_MAX_MESSAGE_BYTES)
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(s.in, body)
+	return body, err
+}
+
+func (s *lspServer) write(msg rpcMessage) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// a request without result still needs "result": null.
+	if msg.ID != nil && msg.Result == nil && msg.Error == nil {
+		data = append(data[:len(data)-1], []byte(`,"result":null}`)...)
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (s *lspServer) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(rpcMessage{Method: method, Params: data})
+}
+
+func (s *lspServer) handle(msg rpcMessage) (interface{}, *rpcError) {
+	var params textDocumentParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &rpcError{Code: RPC_INVALID_PARAMS, Message: err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           LSP_SYNC_FULL,
+				"completionProvider":         map[string]interface{}{},
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "seqdiag"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.documents[uri] = params.TextDocument.Text
+		s.publishDiagnostics(uri)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.documents[uri] = params.ContentChanges[n-1].Text
+		}
+		s.publishDiagnostics(uri)
+	case "textDocument/didClose":
+		delete(s.documents, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/completion":
+		return s.completion(uri), nil
+	case "textDocument/hover":
+		return s.hover(uri, params.Position), nil
+	case "textDocument/definition":
+		return s.definition(uri, params.Position), nil
+	case "textDocument/formatting":
+		return s.formatting(uri), nil
+	default:
+		if msg.ID != nil && !strings.HasPrefix(msg.Method, "$/") {
+			return nil, &rpcError{Code: RPC_METHOD_NOT_FOUND, Message: "method not supported " + msg.Method}
+		}
+	}
+	return nil, nil
+}
+
+func (s *lspServer) publishDiagnostics(uri string) {
+	text := s.documents[uri]
+	lines := strings.Split(text, "\n")
+	diagnostics := []lspDiagnostic{}
+	result, err := sequence.Validate(text, sequence.DefaultConfig())
+	if err == nil {
+		for _, dg := range result.Diagnostics {
+			diagnostics = append(diagnostics, toLSPDiagnostic(dg, lines))
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+}
+
+// toLSPDiagnostic marks the statement the diagnostic was raised for, from its column to the
+// end of the line. Diagnostics of the whole source mark the start.
+func toLSPDiagnostic(dg sequence.Diagnostic, lines []string) lspDiagnostic {
+	ld := lspDiagnostic{Severity: LSP_SEVERITY_WARNING, Source: "seqdiag", Message: dg.Message}
+	if dg.Severity == sequence.SEVERITY_ERROR {
+		ld.Severity = LSP_SEVERITY_ERROR
+	}
+	if dg.Line > 0 && dg.Line <= len(lines) {
+		line := lines[dg.Line-1]
+		start := 0
+		if dg.Column > 0 {
+			start = dg.Column - 1
+		}
+		ld.Range = lspRange{
+			Start: lspPosition{Line: dg.Line - 1, Character: utf16Len(line[:start])},
+			End:   lspPosition{Line: dg.Line - 1, Character: utf16Len(strings.TrimRight(line, "\r"))},
+		}
+	}
+	return ld
+}
+
+// participants parses the document as far as it goes, participants before an error are kept.
+func (s *lspServer) participants(uri string) []sequence.ParticipantInfo {
+	d, err := sequence.NewDiagram()
+	if err != nil {
+		return nil
+	}
+	d.Parse(s.documents[uri])
+	return d.ParticipantInfo()
+}
+
+func (s *lspServer) completion(uri string) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	participants := s.participants(uri)
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].Messages > participants[j].Messages
+	})
+	for _, p := range participants {
+		items = append(items, lspCompletionItem{Label: p.Name, Kind: LSP_COMPLETION_VARIABLE, Detail: "participant"})
+	}
+	for _, k := range lspKeywords {
+		items = append(items, lspCompletionItem{Label: k, Kind: LSP_COMPLETION_KEYWORD})
+	}
+	return items
+}
+
+// wordAt finds the participant name under the cursor.
+func (s *lspServer) wordAt(uri string, pos lspPosition) (string, lspRange, bool) {
+	lines := strings.Split(s.documents[uri], "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return "", lspRange{}, false
+	}
+	line := lines[pos.Line]
+	at := byteOffset(line, pos.Character)
+	start, end := at, at
+	for start > 0 && isNameByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isNameByte(line[end]) {
+		end++
+	}
+	if start == end {
+		return "", lspRange{}, false
+	}
+	return line[start:end], lspRange{
+		Start: lspPosition{Line: pos.Line, Character: utf16Len(line[:start])},
+		End:   lspPosition{Line: pos.Line, Character: utf16Len(line[:end])},
+	}, true
+}
+
+func (s *lspServer) participantAt(uri string, pos lspPosition) (sequence.ParticipantInfo, lspRange, bool) {
+	word, r, ok := s.wordAt(uri, pos)
+	if !ok {
+		return sequence.ParticipantInfo{}, r, false
+	}
+	for _, p := range s.participants(uri) {
+		if p.Name == word {
+			return p, r, true
+		}
+	}
+	return sequence.ParticipantInfo{}, r, false
+}
+
+func (s *lspServer) hover(uri string, pos lspPosition) interface{} {
+	p, r, ok := s.participantAt(uri, pos)
+	if !ok {
+		return nil
+	}
+	where := fmt.Sprintf("first used on line %d", p.Line)
+	if p.Declared {
+		where = fmt.Sprintf("declared on line %d", p.Line)
+	}
+	return lspHover{
+		Contents: lspMarkup{Kind: "markdown", Value: fmt.Sprintf("**participant %s**\n\nused in %d messages, %s", p.Name, p.Messages, where)},
+		Range:    r,
+	}
+}
+
+// definition goes to the participant declaration, or its first use when it's never declared.
+func (s *lspServer) definition(uri string, pos lspPosition) interface{} {
+	p, _, ok := s.participantAt(uri, pos)
+	if !ok || p.Line == 0 {
+		return nil
+	}
+	lines := strings.Split(s.documents[uri], "\n")
+	line := lines[p.Line-1]
+	start := nameIndex(line, p.Name)
+	return lspLocation{URI: uri, Range: lspRange{
+		Start: lspPosition{Line: p.Line - 1, Character: utf16Len(line[:start])},
+		End:   lspPosition{Line: p.Line - 1, Character: utf16Len(line[:start+len(p.Name)])},
+	}}
+}
+
+// formatting replaces the whole document when FormatSource changes it.
+func (s *lspServer) formatting(uri string) []lspTextEdit {
+	text := s.documents[uri]
+	formatted := sequence.FormatSource(text)
+	if formatted == text {
+		return []lspTextEdit{}
+	}
+	lines := strings.Split(text, "\n")
+	last := lines[len(lines)-1]
+	return []lspTextEdit{{
+		Range:   lspRange{End: lspPosition{Line: len(lines) - 1, Character: utf16Len(last)}},
+		NewText: formatted,
+	}}
+}
+
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// nameIndex finds name as a whole word in line.
+func nameIndex(line string, name string) int {
+	for offset := 0; offset < len(line); {
+		i := strings.Index(line[offset:], name)
+		if i < 0 {
+			break
+		}
+		i += offset
+		end := i + len(name)
+		if (i == 0 || !isNameByte(line[i-1])) && (end == len(line) || !isNameByte(line[end])) {
+			return i
+		}
+		offset = i + 1
+	}
+	return 0
+}
+
+// utf16Len is the length of s in the utf-16 code units lsp positions count in.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// byteOffset converts an lsp character position into a byte offset of line.
+func byteOffset(line string, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type lspSession struct {
+	in *bytes.Buffer
+	id int
+}
+
+func (ls *lspSession) send(method string, params interface{}, request bool) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if request {
+		ls.id++
+		msg["id"] = ls.id
+	}
+	data, _ := json.Marshal(msg)
+	fmt.Fprintf(ls.in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// readMessages splits the output of the server into its messages.
+func readMessages(t *testing.T, out []byte) []map[string]json.RawMessage {
+	s := &lspServer{in: bufio.NewReader(bytes.NewReader(out))}
+	var msgs []map[string]json.RawMessage
+	for {
+		body, err := s.read()
+		if err != nil {
+			return msgs
+		}
+		var msg map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(body, &msg))
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestLSP(t *testing.T) {
+	uri := "file:///docs/login.seq"
+	doc := func(text string) map[string]interface{} {
+		return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri, "text": text}}
+	}
+	at := func(line, character int) map[string]interface{} {
+		return map[string]interface{}{"textDocument": map[string]interface{}{"uri": uri}, "position": map[string]int{"line": line, "character": character}}
+	}
+
+	ls := &lspSession{in: new(bytes.Buffer)}
+	ls.send("initialize", map[string]interface{}{}, true)
+	ls.send("initialized", map[string]interface{}{}, false)
+	ls.send("textDocument/didOpen", doc("participant Bob\nAlice  ->+ Bob:  hello\n  this is wrong\n"), false)
+	ls.send("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri},
+		"contentChanges": []map[string]string{{"text": "participant Bob\nAlice  ->+ Bob:  hello\nalt ok\nBob --> Alice: ok  \nend\n"}},
+	}, false)
+	ls.send("textDocument/completion", at(2, 0), true)
+	ls.send("textDocument/hover", at(1, 12), true)
+	ls.send("textDocument/definition", at(3, 1), true)
+	ls.send("textDocument/formatting", at(0, 0), true)
+	ls.send("textDocument/unknown", at(0, 0), true)
+	ls.send("shutdown", nil, true)
+	ls.send("exit", nil, false)
+
+	out := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := run([]string{"lsp"}, ls.in, out, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+
+	msgs := readMessages(t, out.Bytes())
+	if !assert.Len(t, msgs, 9) {
+		return
+	}
+	assert.Contains(t, string(msgs[0]["result"]), `"hoverProvider":true`)
+
+	// the error on line 3 of the opened document.
+	var published struct {
+		Diagnostics []lspDiagnostic `json:"diagnostics"`
+	}
+	assert.NoError(t, json.Unmarshal(msgs[1]["params"], &published))
+	if assert.Len(t, published.Diagnostics, 1) {
+		assert.Equal(t, LSP_SEVERITY_ERROR, published.Diagnostics[0].Severity)
+		assert.Equal(t, lspRange{Start: lspPosition{Line: 2, Character: 2}, End: lspPosition{Line: 2, Character: 15}}, published.Diagnostics[0].Range)
+	}
+	assert.NoError(t, json.Unmarshal(msgs[2]["params"], &published))
+	assert.Len(t, published.Diagnostics, 1, "only the activation is left open")
+
+	var completion []lspCompletionItem
+	assert.NoError(t, json.Unmarshal(msgs[3]["result"], &completion))
+	labels := []string{}
+	for _, item := range completion {
+		labels = append(labels, item.Label)
+	}
+	assert.Equal(t, []string{"Bob", "Alice"}, labels[:2])
+	assert.NotContains(t, labels, "note over")
+	assert.Contains(t, labels, "loop")
+
+	var hover lspHover
+	assert.NoError(t, json.Unmarshal(msgs[4]["result"], &hover))
+	assert.Contains(t, hover.Contents.Value, "participant Bob")
+	assert.Contains(t, hover.Contents.Value, "used in 2 messages, declared on line 1")
+	assert.Equal(t, lspRange{Start: lspPosition{Line: 1, Character: 11}, End: lspPosition{Line: 1, Character: 14}}, hover.Range)
+
+	var definition lspLocation
+	assert.NoError(t, json.Unmarshal(msgs[5]["result"], &definition))
+	assert.Equal(t, lspRange{Start: lspPosition{Line: 0, Character: 12}, End: lspPosition{Line: 0, Character: 15}}, definition.Range)
+
+	var edits []lspTextEdit
+	assert.NoError(t, json.Unmarshal(msgs[6]["result"], &edits))
+	if assert.Len(t, edits, 1) {
+		assert.Equal(t, "participant Bob\nAlice ->+ Bob: hello\nalt ok\n  Bob --> Alice: ok\nend\n", edits[0].NewText)
+		assert.Equal(t, lspPosition{Line: 5, Character: 0}, edits[0].Range.End)
+	}
+
+	assert.Contains(t, string(msgs[7]["error"]), "-32601")
+	assert.Equal(t, "null", string(msgs[8]["result"]))
+}
+
+func TestLSPExitWithoutShutdown(t *testing.T) {
+	ls := &lspSession{in: new(bytes.Buffer)}
+	ls.send("exit", nil, false)
+	assert.Equal(t, EXIT_INVALID, run([]string{"lsp"}, ls.in, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Equal(t, EXIT_OK, run([]string{"lsp"}, strings.NewReader(""), new(bytes.Buffer), new(bytes.Buffer)))
+}
+
+func TestLSPMessageTooLarge(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n{}", LSP_MAX_MESSAGE_BYTES+1))
+	assert.Equal(t, EXIT_INVALID, run([]string{"lsp"}, in, new(bytes.Buffer), stderr))
+	assert.Contains(t, stderr.String(), "is larger than")
+}
@@ -0,0 +1,70 @@
+// Command seqdiag renders sequence diagrams from the command line.
+//
+//	seqdiag [-o output] [-f format] [files...]
+//
+// Without files the source is read from stdin and the image written to stdout. The output
+// format is taken from -f, then the extension of -o, and defaults to png.
+//
+//	seqdiag watch [-f format] docs/*.seq
+//
+// re-renders the files next to their source whenever they change.
+//
+//	seqdiag encode [-url server] [-f format] [files...]
+//	seqdiag decode <encoded|url>
+//
+// convert between a source and the form used in GET /api/v1/sequence/<format>/<encoded> urls.
+//
+//	seqdiag fmt [-l] [-w] [-d] [-align] [files...]
+//
+// formats sources like gofmt, without files from stdin to stdout.
+//
+//	seqdiag lsp
+//
+// runs a language server on stdin and stdout for editors.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	EXIT_OK      = 0
+	EXIT_INVALID = 1
+	EXIT_USAGE   = 2
+)
+
+type command func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
+
+var commands = map[string]command{
+	"render": runRender,
+	"watch":  runWatch,
+	"encode": runEncode,
+	"decode": runDecode,
+	"fmt":    runFmt,
+	"lsp":    runLSP,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(args[1:], stdin, stdout, stderr)
+		}
+		if args[0] == "help" {
+			fmt.Fprintln(stderr, "usage: seqdiag [render] [-o output] [-f format] [files...]")
+			fmt.Fprintln(stderr, "       seqdiag watch [-f format] [-interval d] [-debounce d] files...")
+			fmt.Fprintln(stderr, "       seqdiag encode [-url server] [-f format] [files...]")
+			fmt.Fprintln(stderr, "       seqdiag decode <encoded|url>")
+			fmt.Fprintln(stderr, "       seqdiag fmt [-l] [-w] [-d] [-align] [files...]")
+			fmt.Fprintln(stderr, "       seqdiag lsp")
+			return EXIT_OK
+		}
+	}
+	// rendering is the default command.
+	return runRender(args, stdin, stdout, stderr)
+}
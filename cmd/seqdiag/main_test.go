@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderStdinToStdout(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := run(nil, strings.NewReader("A -> B: hello\n"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.True(t, bytes.HasPrefix(stdout.Bytes(), []byte("\x89PNG")), "png expected")
+
+	stdout.Reset()
+	code = run([]string{"render", "-f", "svg"}, strings.NewReader("A -> B: hello"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "<svg")
+}
+
+func TestRenderInvalidSource(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := run(nil, strings.NewReader("A -> B: hello\nthis is not valid\n"), stdout, stderr)
+	assert.Equal(t, EXIT_INVALID, code)
+	assert.Empty(t, stdout.Bytes())
+	assert.Contains(t, stderr.String(), "<stdin>:2: error:")
+}
+
+func TestRenderFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seqdiag")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "login.seq")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("A ->+ B: hello\n"), 0644))
+
+	stderr := new(bytes.Buffer)
+	code := run([]string{src}, nil, new(bytes.Buffer), stderr)
+	assert.Equal(t, EXIT_OK, code)
+	// the unbalanced activation is only a warning.
+	assert.Contains(t, stderr.String(), "login.seq:1: warning:")
+	_, err = os.Stat(filepath.Join(dir, "login.png"))
+	assert.NoError(t, err)
+
+	out := filepath.Join(dir, "out.svg")
+	code = run([]string{"-o", out, src}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.Equal(t, EXIT_OK, code)
+	data, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<svg")
+
+	code = run([]string{"-o", filepath.Join(dir, "out.bmp"), src}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.Equal(t, EXIT_USAGE, code)
+
+	code = run([]string{"-o", out, src, src}, nil, new(bytes.Buffer), new(bytes.Buffer))
+	assert.Equal(t, EXIT_USAGE, code)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	code := run([]string{"encode"}, strings.NewReader("A -> B: hello\n"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	encoded := strings.TrimSpace(stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"decode", encoded}, nil, stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.Equal(t, "A -> B: hello\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"encode", "-url", "http://localhost:8080/", "-f", "svg"}, strings.NewReader("A -> B: hello\n"), stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	url := strings.TrimSpace(stdout.String())
+	assert.Equal(t, "http://localhost:8080/api/v1/sequence/svg/"+encoded, url)
+
+	stdout.Reset()
+	code = run([]string{"decode", url}, nil, stdout, stderr)
+	assert.Equal(t, EXIT_OK, code, stderr.String())
+	assert.Equal(t, "A -> B: hello\n", stdout.String())
+
+	assert.Equal(t, EXIT_INVALID, run([]string{"decode", "garbage!"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Equal(t, EXIT_USAGE, run([]string{"decode"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Equal(t, EXIT_USAGE, run([]string{"encode", "-f", "bmp"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+}
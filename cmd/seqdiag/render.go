@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-sequencediagrams"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const STDIO = "-"
+
+func runRender(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "output file, - for stdout")
+	format := fs.String("f", "", fmt.Sprintf("output format %v", sequence.SupportedFormats()))
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{STDIO}
+	}
+	if len(*output) > 0 && len(inputs) > 1 {
+		fmt.Fprintln(stderr, "seqdiag: -o can only be used with a single input")
+		return EXIT_USAGE
+	}
+
+	status := EXIT_OK
+	for _, input := range inputs {
+		out, cfg, err := resolveOutput(input, *output, *format)
+		if err != nil {
+			fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+			return EXIT_USAGE
+		}
+		if !renderFile(input, out, cfg, stdin, stdout, stderr) {
+			status = EXIT_INVALID
+		}
+	}
+	return status
+}
+
+// resolveOutput works out where the image of input goes and in what format.
+func resolveOutput(input string, output string, format string) (string, sequence.Config, error) {
+	cfg := sequence.DefaultConfig()
+
+	if len(format) == 0 && len(output) > 0 && output != STDIO {
+		f, err := sequence.FormatFromExtension(output)
+		if err != nil {
+			return "", cfg, err
+		}
+		format = f
+	}
+	if len(format) > 0 {
+		cfg.Format = format
+	}
+	if !sequence.IsSupportedFormat(cfg.Format) {
+		return "", cfg, fmt.Errorf("unsupported format %s", cfg.Format)
+	}
+
+	if len(output) == 0 {
+		if input == STDIO {
+			output = STDIO
+		} else {
+			// docs/login.seq -> docs/login.png
+			output = strings.TrimSuffix(input, filepath.Ext(input)) + "." + cfg.Format
+		}
+	}
+	return output, cfg, nil
+}
+
+func renderFile(input string, output string, cfg sequence.Config, stdin io.Reader, stdout io.Writer, stderr io.Writer) bool {
+	name, src, err := readSource(input, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+		return false
+	}
+
+	data, warnings, err := sequence.CreateDiagramWithConfig(src, cfg)
+	for _, w := range warnings {
+		printDiagnostic(stderr, name, w)
+	}
+	if err != nil {
+		printError(stderr, name, err)
+		return false
+	}
+
+	if output == STDIO {
+		_, err = stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "seqdiag: %s\n", err.Error())
+		return false
+	}
+	return true
+}
+
+func readSource(input string, stdin io.Reader) (string, string, error) {
+	if input == STDIO {
+		data, err := ioutil.ReadAll(stdin)
+		return "<stdin>", string(data), err
+	}
+	data, err := ioutil.ReadFile(input)
+	return input, string(data), err
+}
+
+func printError(w io.Writer, name string, err error) {
+	if dg, ok := err.(sequence.Diagnostic); ok {
+		printDiagnostic(w, name, dg)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", name, err.Error())
+}
+
+// printDiagnostic writes file:line: severity: message like the go tools do.
+func printDiagnostic(w io.Writer, name string, dg sequence.Diagnostic) {
+	fmt.Fprintf(w, "%s:%d: %s: %s\n", name, dg.Line, dg.Severity, dg.Message)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-sequencediagrams"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type pendingChange struct {
+	state fileState
+	since time.Time
+}
+
+// watcher polls the files matching its patterns and re-renders them once they stop changing
+// for the debounce duration, editors tend to save in several writes.
+type watcher struct {
+	patterns []string
+	format   string
+	debounce time.Duration
+	stdout   io.Writer
+	stderr   io.Writer
+
+	rendered map[string]fileState
+	pending  map[string]pendingChange
+}
+
+func newWatcher(patterns []string, format string, debounce time.Duration, stdout io.Writer, stderr io.Writer) *watcher {
+	return &watcher{
+		patterns: patterns,
+		format:   format,
+		debounce: debounce,
+		stdout:   stdout,
+		stderr:   stderr,
+		rendered: make(map[string]fileState),
+		pending:  make(map[string]pendingChange),
+	}
+}
+
+// files expands the patterns on every poll so new files are picked up.
+func (w *watcher) files() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range w.patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// poll renders the files whose changes have settled and returns them.
+func (w *watcher) poll(now time.Time) []string {
+	var done []string
+	for _, file := range w.files() {
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		state := fileState{modTime: info.ModTime(), size: info.Size()}
+		if last, ok := w.rendered[file]; ok && last == state {
+			delete(w.pending, file)
+			continue
+		}
+		p, ok := w.pending[file]
+		if !ok || p.state != state {
+			// new change, start ( or restart ) the debounce.
+			p = pendingChange{state: state, since: now}
+			w.pending[file] = p
+		}
+		if now.Sub(p.since) < w.debounce {
+			continue
+		}
+		w.render(file)
+		w.rendered[file] = state
+		delete(w.pending, file)
+		done = append(done, file)
+	}
+	return done
+}
+
+// renderAll renders every file straight away, used on start.
+func (w *watcher) renderAll() {
+	for _, file := range w.files() {
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		w.render(file)
+		w.rendered[file] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+}
+
+func (w *watcher) render(file string) {
+	out, cfg, err := resolveOutput(file, "", w.format)
+	if err != nil {
+		fmt.Fprintf(w.stderr, "seqdiag: %s\n", err.Error())
+		return
+	}
+	// on failure the previous image stays in place.
+	if renderFile(file, out, cfg, nil, w.stdout, w.stderr) {
+		fmt.Fprintf(w.stdout, "%s rendered %s -> %s\n", time.Now().Format("15:04:05"), file, out)
+	}
+}
+
+func runWatch(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("f", "", "output format")
+	interval := fs.Duration("interval", 250*time.Millisecond, "how often to check the files")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "how long a file has to be unchanged before rendering")
+	if err := fs.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: seqdiag watch [-f format] [-interval d] [-debounce d] files...")
+		return EXIT_USAGE
+	}
+	if len(*format) > 0 && !sequence.IsSupportedFormat(*format) {
+		fmt.Fprintf(stderr, "seqdiag: unsupported format %s\n", *format)
+		return EXIT_USAGE
+	}
+
+	w := newWatcher(fs.Args(), *format, *debounce, stdout, stderr)
+	if len(w.files()) == 0 {
+		fmt.Fprintln(stderr, "seqdiag: no files to watch")
+		return EXIT_USAGE
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	w.renderAll()
+
+	for {
+		select {
+		case <-stop:
+			return EXIT_OK
+		case now := <-ticker.C:
+			w.poll(now)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherDebouncesAndKeepsLastGoodImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seqdiag")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "flow.seq")
+	out := filepath.Join(dir, "flow.png")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("A -> B: hello\n"), 0644))
+
+	stderr := new(bytes.Buffer)
+	w := newWatcher([]string{filepath.Join(dir, "*.seq")}, "", time.Second, new(bytes.Buffer), stderr)
+	w.renderAll()
+	good, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+
+	// nothing changed, nothing to do.
+	now := time.Now()
+	assert.Empty(t, w.poll(now))
+
+	// a broken save is only rendered once it settles and leaves the image alone.
+	assert.NoError(t, ioutil.WriteFile(src, []byte("A -> B: hello\nbroken line\n"), 0644))
+	assert.NoError(t, os.Chtimes(src, now.Add(time.Minute), now.Add(time.Minute)))
+	assert.Empty(t, w.poll(now), "change should wait for the debounce")
+	assert.Empty(t, w.poll(now.Add(500*time.Millisecond)))
+	assert.Equal(t, []string{src}, w.poll(now.Add(1500*time.Millisecond)))
+	assert.Contains(t, stderr.String(), "flow.seq:2: error:")
+	data, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, good, data)
+
+	// the fix is rendered and replaces the image.
+	assert.NoError(t, ioutil.WriteFile(src, []byte("A -> B: hello\nB -> C: again\n"), 0644))
+	assert.NoError(t, os.Chtimes(src, now.Add(2*time.Minute), now.Add(2*time.Minute)))
+	assert.Empty(t, w.poll(now.Add(2*time.Second)))
+	assert.Equal(t, []string{src}, w.poll(now.Add(4*time.Second)))
+	data, err = ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.NotEqual(t, good, data)
+
+	// new files matching the pattern are picked up.
+	other := filepath.Join(dir, "other.seq")
+	assert.NoError(t, ioutil.WriteFile(other, []byte("X -> Y: hi\n"), 0644))
+	assert.Empty(t, w.poll(now.Add(5*time.Second)))
+	assert.Equal(t, []string{other}, w.poll(now.Add(7*time.Second)))
+}
+
+func TestWatchUsage(t *testing.T) {
+	assert.Equal(t, EXIT_USAGE, run([]string{"watch"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Equal(t, EXIT_USAGE, run([]string{"watch", "-f", "bmp", "x.seq"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Equal(t, EXIT_USAGE, run([]string{"watch", "/does/not/exist/*.seq"}, nil, new(bytes.Buffer), new(bytes.Buffer)))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	"go-sequencediagrams"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// AuthConfig turns on jwt authentication of the api when Key is set.
+type AuthConfig struct {
+	// HS256 signing key.
+	Key               string `json:"key"`
+	Realm             string `json:"realm"`
+	TimeoutMinutes    int    `json:"timeout_minutes"`
+	MaxRefreshMinutes int    `json:"max_refresh_minutes"`
+	AllowAnonymous    bool   `json:"allow_anonymous"`
+	// users allowed to log in, name -> bcrypt hash of the password ( htpasswd -nbB name password
+	// prints one after the colon ).
+	Users map[string]string `json:"users"`
+	// the tenant of each user, written into its tokens, users without one are a tenant of their own.
+	Tenants map[string]string `json:"tenants"`
+}
+
+func (cfg AuthConfig) Enabled() bool {
+	return len(cfg.Key) > 0
+}
+
+type login struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// NewAuthMiddleware returns nil when authentication is not configured.
+func NewAuthMiddleware(cfg AuthConfig) *jwt.GinJWTMiddleware {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &jwt.GinJWTMiddleware{
+		Realm:      cfg.Realm,
+		Key:        []byte(cfg.Key),
+		Timeout:    time.Duration(cfg.TimeoutMinutes) * time.Minute,
+		MaxRefresh: time.Duration(cfg.MaxRefreshMinutes) * time.Minute,
+		Authenticator: func(c *gin.Context) (interface{}, error) {
+			var l login
+			if err := c.ShouldBindJSON(&l); err != nil {
+				return nil, jwt.ErrMissingLoginValues
+			}
+			if !cfg.CheckPassword(l.Username, l.Password) {
+				return nil, jwt.ErrFailedAuthentication
+			}
+			return l.Username, nil
+		},
+		PayloadFunc: func(data interface{}) jwt.MapClaims {
+			username := fmt.Sprint(data)
+			return jwt.MapClaims{"id": username, sequence.TENANT_CLAIM: cfg.Tenant(username)}
+		},
+	}
+}
+
+// Tenant is the tenant the requests of username work in.
+func (cfg AuthConfig) Tenant(username string) string {
+	if tenant, ok := cfg.Tenants[username]; ok {
+		return tenant
+	}
+	return username
+}
+
+func (cfg AuthConfig) CheckPassword(username string, password string) bool {
+	hash, ok := cfg.Users[username]
+	if !ok {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-sequencediagrams"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig is read from ( in increasing order of priority ) the defaults, the config file,
+// the SEQSERVER_* environment variables and the command line flags.
+type ServerConfig struct {
+	Addr            string          `json:"addr"`
+	TLSCert         string          `json:"tls_cert"`
+	TLSKey          string          `json:"tls_key"`
+	CORSOrigins     []string        `json:"cors_origins"`
+	MaxBodyBytes    int64           `json:"max_body_bytes"`
+	ShutdownTimeout int             `json:"shutdown_timeout_seconds"`
+	Render          sequence.Config `json:"render"`
+	Auth            AuthConfig      `json:"auth"`
+	Store           StoreConfig     `json:"store"`
+	Cache           CacheConfig     `json:"cache"`
+	Limits          sequence.Limits `json:"limits"`
+	// renders taking longer fail with a 503, 0 for no timeout.
+	RenderTimeout int `json:"render_timeout_seconds"`
+	// serve the browser editor at /.
+	Editor bool `json:"editor"`
+}
+
+const (
+	STORE_NONE   = ""
+	STORE_MEMORY = "memory"
+	STORE_FILE   = "file"
+)
+
+// StoreConfig picks where rendered diagrams are kept, nothing is stored by default.
+type StoreConfig struct {
+	Type string `json:"type"`
+	// directory of the file store.
+	Path string `json:"path"`
+}
+
+// CacheConfig limits the render cache, a MaxBytes of 0 turns it off.
+type CacheConfig struct {
+	MaxBytes   int64 `json:"max_bytes"`
+	TTLSeconds int   `json:"ttl_seconds"`
+	// how long clients may keep images that never change.
+	MaxAgeSeconds int `json:"max_age_seconds"`
+}
+
+func (cfg CacheConfig) TTL() time.Duration {
+	return time.Duration(cfg.TTLSeconds) * time.Second
+}
+
+func (cfg CacheConfig) MaxAge() time.Duration {
+	return time.Duration(cfg.MaxAgeSeconds) * time.Second
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Addr:            ":8080",
+		MaxBodyBytes:    1 << 20,
+		ShutdownTimeout: 10,
+		Render:          sequence.DefaultConfig(),
+		Auth: AuthConfig{
+			Realm:             "seqserver",
+			TimeoutMinutes:    60,
+			MaxRefreshMinutes: 24 * 60,
+		},
+		Cache: CacheConfig{
+			MaxBytes:      64 << 20,
+			TTLSeconds:    60 * 60,
+			MaxAgeSeconds: 24 * 60 * 60,
+		},
+		Limits:        sequence.DefaultLimits(),
+		RenderTimeout: 10,
+		Editor:        true,
+	}
+}
+
+func (cfg ServerConfig) TLSEnabled() bool {
+	return len(cfg.TLSCert) > 0 || len(cfg.TLSKey) > 0
+}
+
+func (cfg ServerConfig) ShutdownDuration() time.Duration {
+	return time.Duration(cfg.ShutdownTimeout) * time.Second
+}
+
+func (cfg ServerConfig) RenderDuration() time.Duration {
+	return time.Duration(cfg.RenderTimeout) * time.Second
+}
+
+func (cfg ServerConfig) Validate() error {
+	if len(cfg.Addr) == 0 {
+		return fmt.Errorf("Listen address is required")
+	}
+	if cfg.TLSEnabled() && (len(cfg.TLSCert) == 0 || len(cfg.TLSKey) == 0) {
+		return fmt.Errorf("Both tls cert and key are required for tls")
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		return fmt.Errorf("Invalid max body size %d", cfg.MaxBodyBytes)
+	}
+	switch cfg.Store.Type {
+	case STORE_NONE, STORE_MEMORY:
+	case STORE_FILE:
+		if len(cfg.Store.Path) == 0 {
+			return fmt.Errorf("File store needs a path")
+		}
+	default:
+		return fmt.Errorf("Unknown store %s", cfg.Store.Type)
+	}
+	if cfg.Cache.MaxBytes < 0 || cfg.Cache.TTLSeconds < 0 || cfg.Cache.MaxAgeSeconds < 0 {
+		return fmt.Errorf("Invalid cache limits")
+	}
+	l := cfg.Limits
+	if l.MaxSourceBytes < 0 || l.MaxLines < 0 || l.MaxParticipants < 0 || l.MaxMessageLength < 0 || l.MaxImagePixels < 0 ||
+		l.MaxTextCells < 0 {
+		return fmt.Errorf("Invalid render limits")
+	}
+	if cfg.RenderTimeout < 0 {
+		return fmt.Errorf("Invalid render timeout %d", cfg.RenderTimeout)
+	}
+	if cfg.Auth.Enabled() && cfg.Auth.TimeoutMinutes <= 0 {
+		return fmt.Errorf("Invalid token timeout %d", cfg.Auth.TimeoutMinutes)
+	}
+	return cfg.Render.Validate()
+}
+
+func NewStore(cfg StoreConfig) (sequence.DiagramStore, error) {
+	switch cfg.Type {
+	case STORE_MEMORY:
+		return sequence.NewMemoryStore(), nil
+	case STORE_FILE:
+		return sequence.NewFileStore(cfg.Path)
+	}
+	return nil, nil
+}
+
+func NewRenderCache(cfg CacheConfig) *sequence.RenderCache {
+	if cfg.MaxBytes == 0 {
+		return nil
+	}
+	return sequence.NewRenderCache(cfg.MaxBytes, cfg.TTL())
+}
+
+// LoadConfig builds the configuration from args ( without the program name ) and getenv.
+func LoadConfig(args []string, getenv func(string) string) (ServerConfig, error) {
+	cfg := DefaultServerConfig()
+
+	fs := flag.NewFlagSet("seqserver", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("SEQSERVER_CONFIG"), "path to a json config file")
+	addr := fs.String("addr", "", "listen address")
+	tlsCert := fs.String("tls-cert", "", "tls certificate file")
+	tlsKey := fs.String("tls-key", "", "tls key file")
+	corsOrigins := fs.String("cors-origins", "", "comma separated list of allowed origins, * for any")
+	maxBody := fs.Int64("max-body-bytes", 0, "maximum size of a request body")
+	shutdown := fs.Int("shutdown-timeout", 0, "seconds to wait for requests on shutdown")
+	format := fs.String("format", "", "default output format")
+	sequenceFont := fs.Float64("sequence-font-size", 0, "font size of the messages")
+	participantFont := fs.Float64("participant-font-size", 0, "font size of the participants")
+	jwtKey := fs.String("jwt-key", "", "signing key for the api tokens, authentication is off without it")
+	store := fs.String("store", "", "where to keep rendered diagrams: memory or file")
+	storePath := fs.String("store-path", "", "directory of the file store")
+	cacheBytes := fs.Int64("cache-max-bytes", 0, "size of the render cache, 0 turns it off")
+	cacheTTL := fs.Int("cache-ttl", 0, "seconds a rendered image is cached, 0 for no limit")
+	maxAge := fs.Int("max-age", 0, "seconds clients may cache images that never change")
+	renderTimeout := fs.Int("render-timeout", 0, "seconds a render may take, 0 for no limit")
+	editor := fs.Bool("editor", true, "serve the browser editor at /")
+	allowAnonymous := fs.Bool("allow-anonymous", false, "allow requests without a token when authentication is on")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if len(*configFile) > 0 {
+		data, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("Invalid config file %s: %s", *configFile, err.Error())
+		}
+	}
+
+	if err := applyEnv(&cfg, getenv); err != nil {
+		return cfg, err
+	}
+
+	// only the flags given on the command line override the rest.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = *addr
+		case "tls-cert":
+			cfg.TLSCert = *tlsCert
+		case "tls-key":
+			cfg.TLSKey = *tlsKey
+		case "cors-origins":
+			cfg.CORSOrigins = splitList(*corsOrigins)
+		case "max-body-bytes":
+			cfg.MaxBodyBytes = *maxBody
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = *shutdown
+		case "format":
+			cfg.Render.Format = *format
+		case "sequence-font-size":
+			cfg.Render.SequenceFontSize = *sequenceFont
+		case "participant-font-size":
+			cfg.Render.ParticipantFontSize = *participantFont
+		case "jwt-key":
+			cfg.Auth.Key = *jwtKey
+		case "allow-anonymous":
+			cfg.Auth.AllowAnonymous = *allowAnonymous
+		case "store":
+			cfg.Store.Type = *store
+		case "store-path":
+			cfg.Store.Path = *storePath
+		case "cache-max-bytes":
+			cfg.Cache.MaxBytes = *cacheBytes
+		case "cache-ttl":
+			cfg.Cache.TTLSeconds = *cacheTTL
+		case "max-age":
+			cfg.Cache.MaxAgeSeconds = *maxAge
+		case "render-timeout":
+			cfg.RenderTimeout = *renderTimeout
+		case "editor":
+			cfg.Editor = *editor
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+func applyEnv(cfg *ServerConfig, getenv func(string) string) error {
+	if v := getenv("SEQSERVER_ADDR"); len(v) > 0 {
+		cfg.Addr = v
+	}
+	if v := getenv("SEQSERVER_TLS_CERT"); len(v) > 0 {
+		cfg.TLSCert = v
+	}
+	if v := getenv("SEQSERVER_TLS_KEY"); len(v) > 0 {
+		cfg.TLSKey = v
+	}
+	if v := getenv("SEQSERVER_CORS_ORIGINS"); len(v) > 0 {
+		cfg.CORSOrigins = splitList(v)
+	}
+	if v := getenv("SEQSERVER_MAX_BODY_BYTES"); len(v) > 0 {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_MAX_BODY_BYTES %s", v)
+		}
+		cfg.MaxBodyBytes = n
+	}
+	if v := getenv("SEQSERVER_SHUTDOWN_TIMEOUT"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_SHUTDOWN_TIMEOUT %s", v)
+		}
+		cfg.ShutdownTimeout = n
+	}
+	if v := getenv("SEQSERVER_FORMAT"); len(v) > 0 {
+		cfg.Render.Format = v
+	}
+	if v := getenv("SEQSERVER_SEQUENCE_FONT_SIZE"); len(v) > 0 {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_SEQUENCE_FONT_SIZE %s", v)
+		}
+		cfg.Render.SequenceFontSize = n
+	}
+	if v := getenv("SEQSERVER_PARTICIPANT_FONT_SIZE"); len(v) > 0 {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_PARTICIPANT_FONT_SIZE %s", v)
+		}
+		cfg.Render.ParticipantFontSize = n
+	}
+	if v := getenv("SEQSERVER_STORE"); len(v) > 0 {
+		cfg.Store.Type = v
+	}
+	if v := getenv("SEQSERVER_STORE_PATH"); len(v) > 0 {
+		cfg.Store.Path = v
+	}
+	if v := getenv("SEQSERVER_CACHE_MAX_BYTES"); len(v) > 0 {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_CACHE_MAX_BYTES %s", v)
+		}
+		cfg.Cache.MaxBytes = n
+	}
+	if v := getenv("SEQSERVER_CACHE_TTL"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_CACHE_TTL %s", v)
+		}
+		cfg.Cache.TTLSeconds = n
+	}
+	if v := getenv("SEQSERVER_MAX_AGE"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_MAX_AGE %s", v)
+		}
+		cfg.Cache.MaxAgeSeconds = n
+	}
+	if v := getenv("SEQSERVER_RENDER_TIMEOUT"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_RENDER_TIMEOUT %s", v)
+		}
+		cfg.RenderTimeout = n
+	}
+	if v := getenv("SEQSERVER_EDITOR"); len(v) > 0 {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_EDITOR %s", v)
+		}
+		cfg.Editor = b
+	}
+	if v := getenv("SEQSERVER_JWT_KEY"); len(v) > 0 {
+		cfg.Auth.Key = v
+	}
+	if v := getenv("SEQSERVER_ALLOW_ANONYMOUS"); len(v) > 0 {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("Invalid SEQSERVER_ALLOW_ANONYMOUS %s", v)
+		}
+		cfg.Auth.AllowAnonymous = b
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
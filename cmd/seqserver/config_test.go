@@ -0,0 +1,191 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go-sequencediagrams"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig(nil, envMap(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultServerConfig(), cfg)
+	assert.False(t, cfg.TLSEnabled())
+}
+
+func TestLoadConfigPriority(t *testing.T) {
+	f, err := ioutil.TempFile("", "seqserver")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`{"addr": ":9000", "max_body_bytes": 100, "cors_origins": ["http://a"], "render": {"sequence_font_size": 10, "participant_font_size": 11}}`)
+	assert.NoError(t, err)
+	f.Close()
+
+	// env overrides the file, flags override the env.
+	env := envMap(map[string]string{
+		"SEQSERVER_CONFIG":         f.Name(),
+		"SEQSERVER_ADDR":           ":9100",
+		"SEQSERVER_MAX_BODY_BYTES": "200",
+	})
+	cfg, err := LoadConfig([]string{"-addr", ":9200", "-participant-font-size", "20"}, env)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9200", cfg.Addr)
+	assert.Equal(t, int64(200), cfg.MaxBodyBytes)
+	assert.Equal(t, []string{"http://a"}, cfg.CORSOrigins)
+	assert.Equal(t, 10.0, cfg.Render.SequenceFontSize)
+	assert.Equal(t, 20.0, cfg.Render.ParticipantFontSize)
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	_, err := LoadConfig([]string{"-tls-cert", "cert.pem"}, envMap(nil))
+	assert.Error(t, err, "tls needs a key as well")
+
+	_, err = LoadConfig(nil, envMap(map[string]string{"SEQSERVER_MAX_BODY_BYTES": "lots"}))
+	assert.Error(t, err)
+
+	_, err = LoadConfig([]string{"-sequence-font-size", "-1"}, envMap(nil))
+	assert.Error(t, err)
+
+	_, err = LoadConfig([]string{"-cache-ttl", "-1"}, envMap(nil))
+	assert.Error(t, err)
+
+	_, err = LoadConfig([]string{"-render-timeout", "-1"}, envMap(nil))
+	assert.Error(t, err)
+}
+
+func TestRouterRenderLimits(t *testing.T) {
+	cfg, err := LoadConfig(nil, envMap(map[string]string{"SEQSERVER_RENDER_TIMEOUT": "5"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cfg.RenderTimeout)
+	cfg.Limits.MaxParticipants = 1
+	router, err := NewRouter(cfg)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/sequence/", strings.NewReader("A -> B: hi")))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestLoadConfigCache(t *testing.T) {
+	cfg, err := LoadConfig([]string{"-cache-max-bytes", "0"}, envMap(map[string]string{"SEQSERVER_CACHE_TTL": "5"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cfg.Cache.TTLSeconds)
+	assert.Nil(t, NewRenderCache(cfg.Cache), "a size of 0 turns the cache off")
+	assert.NotNil(t, NewRenderCache(DefaultServerConfig().Cache))
+}
+
+func TestRouterLimitsAndCORS(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.MaxBodyBytes = 10
+	cfg.CORSOrigins = []string{"http://editor"}
+	router, err := NewRouter(cfg)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sequence/", strings.NewReader("A -> B: too long for the limit"))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/sequence/", nil)
+	req.Header.Set("Origin", "http://editor")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "http://editor", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/sequence/", strings.NewReader("A -> B: hi"))
+	req.Header.Set("Origin", "http://other")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestRouterAuth(t *testing.T) {
+	cfg := DefaultServerConfig()
+	cfg.Auth.Key = "local test key"
+	// bcrypt of "secret"
+	cfg.Auth.Users = map[string]string{"alice": "$2a$04$r/LOhJXnyyD1TEGF8e7Q8.HauB9FBkXcESZlsmJ5tMMlTyvL6SbYG"}
+	router, err := NewRouter(cfg)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/sequence/", strings.NewReader("A -> B: hi")))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username": "alice", "password": "secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "token")
+
+	assert.True(t, cfg.Auth.CheckPassword("alice", "secret"))
+	assert.False(t, cfg.Auth.CheckPassword("alice", "wrong"))
+	assert.False(t, cfg.Auth.CheckPassword("bob", "secret"))
+	// a plain sha256 of the password is not accepted anymore.
+	cfg.Auth.Users["alice"] = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+	assert.False(t, cfg.Auth.CheckPassword("alice", "secret"))
+
+	// the tokens name the tenant of the user.
+	assert.Equal(t, "alice", NewAuthMiddleware(cfg.Auth).PayloadFunc("alice")[sequence.TENANT_CLAIM])
+	cfg.Auth.Tenants = map[string]string{"alice": "acme"}
+	assert.Equal(t, "acme", NewAuthMiddleware(cfg.Auth).PayloadFunc("alice")[sequence.TENANT_CLAIM])
+}
+
+func TestRouterStore(t *testing.T) {
+	_, err := LoadConfig([]string{"-store", "file"}, envMap(nil))
+	assert.Error(t, err, "file store needs a path")
+
+	cfg, err := LoadConfig(nil, envMap(map[string]string{"SEQSERVER_STORE": "memory"}))
+	assert.Nil(t, err)
+	router, err := NewRouter(cfg)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sequence/", strings.NewReader("A -> B: hi"))
+	req.Header.Set("tenantID", "acme")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := w.Header().Get("X-Sequence-Id")
+	assert.NotEmpty(t, id)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/sequence/"+id, nil)
+	req.Header.Set("tenantID", "acme")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tenant_id":"acme"`)
+}
+
+func TestRouterEditor(t *testing.T) {
+	router, err := NewRouter(DefaultServerConfig())
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cfg, err := LoadConfig([]string{"-editor=false"}, envMap(nil))
+	assert.Nil(t, err)
+	router, err = NewRouter(cfg)
+	assert.Nil(t, err)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	srv := NewServer(DefaultServerConfig(), http.NotFoundHandler())
+	assert.Equal(t, ":8080", srv.Addr)
+	assert.Equal(t, READ_HEADER_TIMEOUT, srv.ReadHeaderTimeout)
+	assert.Equal(t, IDLE_TIMEOUT, srv.IdleTimeout)
+}
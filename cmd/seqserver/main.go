@@ -0,0 +1,101 @@
+// Command seqserver serves the sequence diagram api.
+package main
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go-sequencediagrams"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	cfg, err := LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("seqserver: %s", err.Error())
+	}
+
+	router, err := NewRouter(cfg)
+	if err != nil {
+		log.Fatalf("seqserver: %s", err.Error())
+	}
+	srv := NewServer(cfg, router)
+
+	go func() {
+		log.Printf("seqserver: listening on %s", cfg.Addr)
+		var err error
+		if cfg.TLSEnabled() {
+			err = srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("seqserver: %s", err.Error())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Printf("seqserver: shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDuration())
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatalf("seqserver: shutdown failed %s", err.Error())
+	}
+}
+
+// slow clients can't hold connections open forever. There is no read or write timeout, live
+// previews stream for as long as the editor is open.
+const (
+	READ_HEADER_TIMEOUT = 10 * time.Second
+	IDLE_TIMEOUT        = 2 * time.Minute
+)
+
+func NewServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
+	}
+}
+
+func NewRouter(cfg ServerConfig) (*gin.Engine, error) {
+	store, err := NewStore(cfg.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery())
+	if len(cfg.CORSOrigins) > 0 {
+		router.Use(CORS(cfg.CORSOrigins))
+	}
+	router.Use(LimitBody(cfg.MaxBodyBytes))
+
+	handlerConfig := sequence.HandlerConfig{
+		Render:         cfg.Render,
+		AllowAnonymous: cfg.Auth.AllowAnonymous,
+		Cache:          NewRenderCache(cfg.Cache),
+		MaxAge:         cfg.Cache.MaxAge(),
+		Limits:         cfg.Limits,
+		RenderTimeout:  cfg.RenderDuration(),
+	}
+	// a nil *FileStore in the interface would look like a store.
+	if store != nil {
+		handlerConfig.Store = store
+	}
+	if err := sequence.RegisterSequenceHandlerWithConfig(router, NewAuthMiddleware(cfg.Auth), handlerConfig); err != nil {
+		return nil, err
+	}
+	if cfg.Editor {
+		sequence.RegisterEditorHandler(router)
+	}
+	return router, nil
+}
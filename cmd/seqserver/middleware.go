@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-sequencediagrams"
+	"net/http"
+	"strings"
+)
+
+// CORS allows the listed origins ( or any with * ) to call the api from a browser.
+func CORS(origins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		allowed[o] = true
+	}
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origin) == 0 || (!allowed["*"] && !allowed[origin]) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, tenantID")
+		c.Header("Access-Control-Expose-Headers", strings.Join([]string{
+			sequence.HEADER_WARNINGS, sequence.HEADER_DIAGRAM_ID, sequence.HEADER_REVISION, sequence.HEADER_BATCH_FAILURES, "ETag",
+		}, ", "))
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitBody rejects request bodies larger than max bytes.
+func LimitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
+		// chunked bodies don't carry a length, cap the reader instead.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package sequence
+
+import "fmt"
+
+// Config holds the rendering defaults used for a diagram.
+type Config struct {
+	// output format, one of SupportedFormats()
+	Format              string  `json:"format"`
+	SequenceFontSize    float64 `json:"sequence_font_size"`
+	ParticipantFontSize float64 `json:"participant_font_size"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Format:              FORMAT_PNG,
+		SequenceFontSize:    12,
+		ParticipantFontSize: 14,
+	}
+}
+
+func (cfg Config) Validate() error {
+	if !IsSupportedFormat(cfg.Format) {
+		return fmt.Errorf("Unsupported format %s", cfg.Format)
+	}
+	if cfg.SequenceFontSize <= 0 {
+		return fmt.Errorf("Invalid sequence font size %v", cfg.SequenceFontSize)
+	}
+	if cfg.ParticipantFontSize <= 0 {
+		return fmt.Errorf("Invalid participant font size %v", cfg.ParticipantFontSize)
+	}
+	return nil
+}
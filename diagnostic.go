@@ -0,0 +1,58 @@
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+// Diagnostic is a problem found in the diagram source, tied to the (1 based) line it was found on.
+// Column is where the statement on that line starts, 0 when the whole source is meant. Diagrams
+// built from a json Document have no lines, Path is the element instead ( elements[2] ).
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (dg Diagnostic) Error() string {
+	if len(dg.Path) > 0 {
+		return fmt.Sprintf("%s: %s", dg.Path, dg.Message)
+	}
+	return fmt.Sprintf("line %d: %s", dg.Line, dg.Message)
+}
+
+func (d *Diagram) AddWarning(line int, format string, args ...interface{}) {
+	d.warnings = append(d.warnings, Diagnostic{Severity: SEVERITY_WARNING, Line: line, Column: d.column(line), Message: fmt.Sprintf(format, args...)})
+}
+
+// errorAt turns an error raised while parsing line into a Diagnostic.
+func (d *Diagram) errorAt(line int, err error) Diagnostic {
+	return Diagnostic{Severity: SEVERITY_ERROR, Line: line, Column: d.column(line), Message: err.Error()}
+}
+
+// column is the (1 based) column of the first non blank character on line.
+func (d *Diagram) column(line int) int {
+	if line < 1 || line > len(d.lines) {
+		return 0
+	}
+	text := d.lines[line-1]
+	return len(text) - len(strings.TrimLeft(text, " \t")) + 1
+}
+
+// Warnings returns a copy of the warnings raised while parsing, ordered by line. The diagram
+// is left as it is, so it can be shared.
+func (d *Diagram) Warnings() []Diagnostic {
+	warnings := append([]Diagnostic{}, d.warnings...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Line < warnings[j].Line
+	})
+	return warnings
+}
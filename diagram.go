@@ -1,18 +1,19 @@
 package sequence
 
 import (
-	"go-sequencediagrams/utils"
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
+	"go-sequencediagrams/utils"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/gofont/goregular"
 	"image"
 	"image/color"
-	"image/png"
+	"math"
 	"strings"
+	"sync"
 )
 
 type Diagram struct {
@@ -28,7 +29,21 @@ type Diagram struct {
 	participantHeight int
 	sequenceEndY      int
 	groupList         []*Group
-	// will also include other parameters like font and config for sequence colors.
+	warnings          []Diagnostic
+	// source lines of the last Parse, for the columns of diagnostics.
+	lines []string
+	// line being parsed, participants remember where they first appeared.
+	lineNo int
+	boxes  []*Box
+	// space above the participants, used by box labels.
+	headerHeight int
+	config       Config
+	theme        Theme
+	// pixels per unit of the raster and svg output.
+	scale  float64
+	limits Limits
+	// parsing, layout and rendering stop once it is done.
+	ctx context.Context
 }
 
 const (
@@ -44,6 +59,13 @@ const (
 	ST_GROUP_MESSAGE        = 10
 	ST_ELSE_MESSAGE         = 11
 	ST_END_GROUP            = 12
+	ST_DELAY                = 13
+	ST_DIVIDER              = 14
+	ST_SPACE                = 15
+	ST_REF                  = 16
+	ST_PARTICIPANT          = 17
+	ST_BOX_START            = 18
+	ST_BOX_END              = 19
 )
 
 const (
@@ -59,6 +81,12 @@ const (
 	CONFIG_MESSAGE_ALIGN        = gg.AlignLeft
 	CONFIG_GROUP_MAX_WIDTH      = 300
 	CONFIG_GROUP_BASE_HEIGHT    = 30
+	CONFIG_DELAY_HEIGHT         = 20
+	CONFIG_DIVIDER_HEIGHT       = 20
+	CONFIG_DIVIDER_GAP          = 4
+	CONFIG_BOX_PADDING          = 10
+	// height of ||| , the room between two messages three times over.
+	CONFIG_SPACE_HEIGHT = 3 * CONFIG_MIN_PADDING_Y
 )
 
 var CONFIG_SEQUENCE_LINE_COLOR = color.RGBA{0, 0, 0, 255}
@@ -66,12 +94,21 @@ var CONFIG_PROCESS_LINE_COLOR = color.RGBA{0, 0, 0, 255}
 var CONFIG_GROUP_LINE_COLOR = color.RGBA{0, 0, 0xff, 255}
 var CONFIG_GROUP_BG_FILL_COLOR = color.RGBA{0xff, 0xff, 0xff, 255}
 var CONFIG_GROUP_TEXT_COLOR = CONFIG_GROUP_LINE_COLOR
+var CONFIG_SEPARATOR_LINE_COLOR = color.RGBA{0x80, 0x80, 0x80, 255}
+var CONFIG_SEPARATOR_BG_FILL_COLOR = color.RGBA{0xee, 0xee, 0xee, 255}
+var CONFIG_SEPARATOR_TEXT_COLOR = color.RGBA{0, 0, 0, 255}
+var CONFIG_REF_LINE_COLOR = color.RGBA{0, 0, 0, 255}
+var CONFIG_REF_BG_FILL_COLOR = color.RGBA{0xff, 0xff, 0xff, 255}
+var CONFIG_REF_TEXT_COLOR = color.RGBA{0, 0, 0, 255}
+var CONFIG_BOX_LINE_COLOR = color.RGBA{0xa0, 0xa0, 0xa0, 255}
+var CONFIG_BOX_BG_FILL_COLOR = color.RGBA{0xf0, 0xf0, 0xf0, 255}
+var CONFIG_BOX_TEXT_COLOR = color.RGBA{0, 0, 0, 255}
 
 func (d *Diagram) GetOrCreateParticipant(name string) *Participant {
 	p, ok := d.participantMap[name]
 	if !ok {
 		// add this participant to the map & the array.
-		np := Participant{name: name}
+		np := Participant{name: name, line: d.lineNo}
 		d.participants = append(d.participants, &np)
 		d.participantMap[name] = len(d.participants) - 1
 		p = d.participantMap[name]
@@ -83,20 +120,45 @@ func (d *Diagram) AddSequence(s Sequence) {
 	d.sequences = append(d.sequences, s)
 }
 
-func NewDiagram( /*typically we will take config here*/ ) (*Diagram, error) {
-	d := Diagram{}
-	// Create a temp context for text operations.
-	d.dc = gg.NewContext(1, 1)
-	d.participantMap = make(map[string]int)
-	font, err := truetype.Parse(goregular.TTF)
+func NewDiagram() (*Diagram, error) {
+	return NewDiagramWithConfig(DefaultConfig())
+}
+
+func NewDiagramWithConfig(cfg Config) (*Diagram, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	font, err := defaultFont()
 	if err != nil {
 		return nil, err
 	}
+	return newDiagram(cfg, font, DefaultTheme(), 1), nil
+}
+
+var (
+	goregularOnce sync.Once
+	goregularFont *truetype.Font
+	goregularErr  error
+)
+
+// defaultFont is goregular, parsed once. Fonts can be shared, their faces can't.
+func defaultFont() (*truetype.Font, error) {
+	goregularOnce.Do(func() {
+		goregularFont, goregularErr = truetype.Parse(goregular.TTF)
+	})
+	return goregularFont, goregularErr
+}
+
+func newDiagram(cfg Config, font *truetype.Font, theme Theme, scale float64) *Diagram {
+	d := Diagram{config: cfg, theme: theme, scale: scale, ctx: context.Background()}
+	// Create a temp context for text operations.
+	d.dc = gg.NewContext(1, 1)
+	d.participantMap = make(map[string]int)
 
-	d.SequenceFont = truetype.NewFace(font, &truetype.Options{Size: 12})
-	d.ParticipantFont = truetype.NewFace(font, &truetype.Options{Size: 14})
+	d.SequenceFont = truetype.NewFace(font, &truetype.Options{Size: cfg.SequenceFontSize})
+	d.ParticipantFont = truetype.NewFace(font, &truetype.Options{Size: cfg.ParticipantFontSize})
 
-	return &d, nil
+	return &d
 }
 
 func (d *Diagram) MeasureParticipant(participant *Participant) utils.Rectangle {
@@ -165,7 +227,7 @@ func (d *Diagram) AdjustXSpace(p1 *Participant, p2 *Participant, xSpace int) err
 	return nil
 }
 
-func (d *Diagram) RenderParticipant(dc *gg.Context, p *Participant, yOffset int) {
+func (d *Diagram) RenderParticipant(dc Canvas, p *Participant, yOffset int) {
 
 	dc.Push()
 	dc.DrawRectangle(float64(p.position.Min.X), float64(p.position.Min.Y+yOffset), float64(p.position.Dx()), float64(p.position.Dy()))
@@ -173,24 +235,38 @@ func (d *Diagram) RenderParticipant(dc *gg.Context, p *Participant, yOffset int)
 	centerX := float64(p.position.Min.X + p.position.Dx()/2)
 	centerY := float64((p.position.Min.Y + p.position.Dy()/2) + yOffset)
 	dc.SetFontFace(d.ParticipantFont)
-	dc.SetRGB(0, 0, 0)
+	dc.SetColor(d.theme.ParticipantText)
 	dc.DrawStringAnchored(p.name, centerX, centerY, 0.5, 0.5)
+	dc.SetColor(d.theme.ParticipantLine)
 	dc.Stroke()
 	dc.Pop()
 }
 
-func (d *Diagram) RenderParticipantLines(dc *gg.Context, p *Participant) {
+func (d *Diagram) RenderParticipantLines(dc Canvas, p *Participant) {
 	dc.Push()
 
-	dc.SetDash(5, 5)
 	rt := p.position
-	x1 := float64(rt.Min.X + rt.Dx()/2)
+	x := float64(rt.Min.X + rt.Dx()/2)
 	y1 := float64(rt.Max.Y)
-	x2 := float64(rt.Min.X + rt.Dx()/2)
-	y2 := float64(d.sequenceEndY)
-	dc.SetRGB(0, 0, 0xff)
+	dc.SetColor(d.theme.Lifeline)
 
-	dc.DrawLine(x1, y1, x2, y2)
+	// delays break the lifeline into a finer dotted segment.
+	for _, s := range d.sequences {
+		if s.Type() != ST_DELAY {
+			continue
+		}
+		pos := s.Position()
+		dc.SetDash(5, 5)
+		dc.DrawLine(x, y1, x, float64(pos.Min.Y))
+		dc.Stroke()
+		dc.SetDash(1, 4)
+		dc.DrawLine(x, float64(pos.Min.Y), x, float64(pos.Max.Y))
+		dc.Stroke()
+		y1 = float64(pos.Max.Y)
+	}
+
+	dc.SetDash(5, 5)
+	dc.DrawLine(x, y1, x, float64(d.sequenceEndY))
 	dc.Stroke()
 	dc.Pop()
 }
@@ -198,43 +274,52 @@ func (d *Diagram) RenderParticipantLines(dc *gg.Context, p *Participant) {
 // decide how to measure string without knowing the width
 
 func CreateDiagram(sequence string) ([]byte, error) {
+	data, _, err := CreateDiagramWithWarnings(sequence)
+	return data, err
+}
 
-	d, err := NewDiagram()
+// CreateDiagramWithWarnings renders the diagram like CreateDiagram and also returns the
+// warnings raised for the source ( unbalanced activations, groups etc. ).
+func CreateDiagramWithWarnings(sequence string) ([]byte, []Diagnostic, error) {
+	return CreateDiagramWithConfig(sequence, DefaultConfig())
+}
+
+// CreateDiagramWithConfig renders with a Renderer made for cfg, services rendering many
+// diagrams should keep a Renderer instead.
+func CreateDiagramWithConfig(sequence string, cfg Config) ([]byte, []Diagnostic, error) {
+	return CreateDiagramContext(context.Background(), sequence, cfg, Limits{})
+}
+
+// CreateDiagramContext renders like CreateDiagramWithConfig within limits, it stops with the
+// error of ctx once ctx is done.
+func CreateDiagramContext(ctx context.Context, sequence string, cfg Config, limits Limits) ([]byte, []Diagnostic, error) {
+	r, err := NewRenderer(WithConfig(cfg), WithLimits(limits))
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, nil, err
 	}
+	return r.RenderContext(ctx, sequence)
+}
 
-	// extract participants and store them in a list
-	// also we have all the necessary objects created.
-	// need to add more types of objects.
-	err = d.Parse(sequence)
-	if err != nil {
-		return []byte{}, err
+// Layout measures and places everything parsed so far, it has to run before Render or Encode.
+func (d *Diagram) Layout() error {
+	if len(d.participants) == 0 {
+		return fmt.Errorf("No participants in sequence")
 	}
 
 	//// precompute lengths each participant and place
-	d.ComputeParticipantSizeAndPlace()
+	err := d.ComputeParticipantSizeAndPlace()
+	if err != nil {
+		return err
+	}
 	//
 	//// Precompute length of message and move if necessary
-	d.ComputeSequenceMessageAndPlace()
-
-	d.RePlaceParticipants()
-
-	w, h := d.ComputeImageSize()
-	//// based on precomputed width and height create the image
-
-	i := d.Render(w, h)
-
-	buf := new(bytes.Buffer)
-
-	err = png.Encode(buf, i)
-
+	err = d.ComputeSequenceMessageAndPlace()
 	if err != nil {
-		return []byte{}, err
+		return err
 	}
 
-	return buf.Bytes(), nil
-
+	d.RePlaceParticipants()
+	return nil
 }
 
 func (p *Participant) SetDelta(delta int) {
@@ -255,80 +340,208 @@ var methodObjectMap = map[int]func() (Sequence, error){
 	ST_GROUP_MESSAGE:        func() (Sequence, error) { return new(StartGroupMessage), nil },
 	//ST_ELSE_MESSAGE:         func() (Sequence, error) { return new(ElseMessage), nil },
 	ST_END_GROUP: func() (Sequence, error) { return new(EndGroupMessage), nil },
+	ST_DELAY:     func() (Sequence, error) { return new(Delay), nil },
+	ST_DIVIDER:   func() (Sequence, error) { return new(Divider), nil },
+	ST_SPACE:     func() (Sequence, error) { return new(Space), nil },
+	ST_REF:       func() (Sequence, error) { return new(Ref), nil },
 }
 
 func (d *Diagram) Parse(sequence string) error {
 
-	groupStack := utils.Stack{}
+	st := &parseState{}
 
 	if len(sequence) == 0 {
 		return fmt.Errorf("Empty sequence")
 	}
 	lines := strings.Split(sequence, "\n")
-	for _, line := range lines {
+	if err := d.limits.checkSource(sequence, len(lines)); err != nil {
+		return err
+	}
+	d.lines = lines
+	for idx, line := range lines {
+		lineNo := idx + 1
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			// blank lines only space out the source ( and end every file ).
+			continue
+		}
 		seq := make(map[string]interface{})
 		jsonstr, typ, err := ParseLine(line)
 		if err != nil {
-			// figure out a way of sending error line
-			return err
+			return d.errorAt(lineNo, err)
 		}
 
 		err = json.Unmarshal([]byte(jsonstr), &seq)
 		if err != nil {
-			// figure out a way of sending error line
-			return err
+			return d.errorAt(lineNo, err)
 		}
 
-		fun := methodObjectMap[typ]
-		if fun == nil {
-			return fmt.Errorf("Internal error %d", typ)
+		if err := d.addStatement(st, seq, typ, lineNo); err != nil {
+			return err
 		}
+		if err := d.limits.checkStatement(d, seq, lineNo); err != nil {
+			return err
+		}
+	}
+	return d.endStatements(st)
+}
 
-		obj, err := fun()
-		obj.Init(seq, d, len(d.sequences), typ)
-		d.AddSequence(obj)
+// parseState is what is still open while statements are added.
+type parseState struct {
+	groupStack utils.Stack
+	currentBox *Box
+}
 
-		if obj.IsStartProcess() {
-			p := Process{}
-			p.start = obj
-			obj.SecondaryParticipant().AddProcess(&p)
-			obj.SetStartProcess(&p)
-		} else if obj.IsEndProcess() {
-			p := obj.PrimaryParticipant().EndProcessAt(obj)
-			obj.SetEndProcess(p)
+// addStatement adds a parsed statement ( the json of ParseLine as a map ) to the diagram,
+// lineNo is what its diagnostics refer to.
+func (d *Diagram) addStatement(st *parseState, seq map[string]interface{}, typ int, lineNo int) error {
+	d.lineNo = lineNo
+	if link, ok := seq["link"].(string); ok {
+		// the space before [[ isn't part of the text.
+		if text, ok := seq["text"].(string); ok {
+			seq["text"] = strings.TrimRight(text, " \t")
 		}
+		if err := ValidateLink(link); err != nil {
+			d.AddWarning(lineNo, "%s", err.Error())
+			delete(seq, "link")
+		}
+	}
+	if target, ok := seq["target"].(string); ok && len(target) > 0 {
+		// the target of a ref is linked like a [[url]].
+		if err := ValidateLink(target); err != nil {
+			d.AddWarning(lineNo, "%s", err.Error())
+			seq["target"] = ""
+		}
+	}
 
-		if typ == ST_GROUP_MESSAGE {
-			// add the start to the group stack
-			g := Group{}
-			g.start = obj.(*StartGroupMessage)
-			g.start.group = &g
-			groupStack.Push(g)
-
+	// declarations only shape the participants, they don't add a sequence.
+	if typ == ST_PARTICIPANT {
+		p := d.GetOrCreateParticipant(seq["name"].(string))
+		if p.declaration == 0 {
+			p.declaration = lineNo
+		}
+		if link, ok := seq["link"].(string); ok {
+			p.link = link
 		}
-		if typ == ST_END_GROUP {
-			// add the else to the current group stack
-			g := groupStack.Pop()
-			if g == nil {
-				return fmt.Errorf("End without group")
+		if st.currentBox != nil {
+			if p.box != nil {
+				d.AddWarning(lineNo, "%s is already in box %s", p.name, p.box.name)
+			} else {
+				st.currentBox.AddParticipant(p)
 			}
-			group := g.(Group)
-			group.end = obj.(*EndGroupMessage)
-			group.end.group = &group
-
-			d.groupList = append(d.groupList, &group)
 		}
-		if typ == ST_ELSE_MESSAGE {
-			// add the end to the current group stack and compute
-			// recompute the group
+		return nil
+	}
+	if typ == ST_BOX_START {
+		if st.currentBox != nil {
+			d.AddWarning(lineNo, "box inside box %s is not supported, closing it", st.currentBox.name)
+		}
+		st.currentBox = &Box{name: seq["text"].(string), line: lineNo}
+		if c := seq["color"].(string); len(c) > 0 {
+			fill, err := utils.ParseColor(c)
+			if err != nil {
+				d.AddWarning(lineNo, "%s", err.Error())
+			} else {
+				st.currentBox.fill = fill
+			}
+		}
+		d.boxes = append(d.boxes, st.currentBox)
+		return nil
+	}
+	if typ == ST_BOX_END {
+		if st.currentBox == nil {
+			d.AddWarning(lineNo, "end box without a matching box")
+		}
+		st.currentBox = nil
+		return nil
+	}
+
+	if typ == ST_END_GROUP && st.groupStack.Count() == 0 {
+		// nothing to close, drop the line rather than failing the whole diagram.
+		d.AddWarning(lineNo, "end without a matching alt or loop")
+		return nil
+	}
+
+	switch typ {
+	case ST_NOTE_OVER, ST_NOTE_LEFT, ST_NOTE_RIGHT:
+		return d.errorAt(lineNo, fmt.Errorf("notes are not supported"))
+	}
+
+	fun := methodObjectMap[typ]
+	if fun == nil {
+		return fmt.Errorf("Internal error %d", typ)
+	}
+
+	obj, err := fun()
+	err = obj.Init(seq, d, len(d.sequences), typ)
+	if err != nil {
+		return d.errorAt(lineNo, err)
+	}
+	d.AddSequence(obj)
+
+	if obj.IsStartProcess() {
+		p := Process{}
+		p.start = obj
+		p.line = lineNo
+		obj.SecondaryParticipant().AddProcess(&p)
+		obj.SetStartProcess(&p)
+	} else if obj.IsEndProcess() {
+		p := obj.PrimaryParticipant().EndProcessAt(obj)
+		if p == nil {
+			d.AddWarning(lineNo, "%s is deactivated without a matching activation", obj.PrimaryParticipant().name)
 		}
+		obj.SetEndProcess(p)
+	}
+
+	if typ == ST_GROUP_MESSAGE {
+		// add the start to the group stack
+		g := Group{}
+		g.start = obj.(*StartGroupMessage)
+		g.start.group = &g
+		g.line = lineNo
+		st.groupStack.Push(g)
 
 	}
-	// split the string into lines
-	// create objects for each line
+	if typ == ST_END_GROUP {
+		// add the else to the current group stack
+		group := st.groupStack.Pop().(Group)
+		group.end = obj.(*EndGroupMessage)
+		group.end.group = &group
 
+		d.groupList = append(d.groupList, &group)
+	}
+	if typ == ST_ELSE_MESSAGE {
+		// add the end to the current group stack and compute
+		// recompute the group
+	}
 	return nil
+}
 
+// endStatements warns about what was left open once all statements are added.
+func (d *Diagram) endStatements(st *parseState) error {
+	// anything still open at this point runs to the end of the diagram.
+	if st.currentBox != nil {
+		d.AddWarning(st.currentBox.line, "box %s is never closed with end box", st.currentBox.name)
+	}
+	for g := st.groupStack.Peek(); g != nil; g = st.groupStack.Peek() {
+		group := g.(Group)
+		d.AddWarning(group.line, "%s is never closed with end, it is closed at the end of the diagram", group.Name())
+		// an end added here frames the group to the last sequence.
+		if err := d.addStatement(st, map[string]interface{}{}, ST_END_GROUP, group.line); err != nil {
+			return err
+		}
+	}
+	for _, p := range d.participants {
+		for _, process := range p.processes {
+			if process.end == nil {
+				d.AddWarning(process.line, "activation of %s is never deactivated", p.name)
+			}
+		}
+	}
+	d.ArrangeBoxedParticipants()
+	return nil
 }
 
 func (d *Diagram) ReComputeGroup(g *Group) {
@@ -370,17 +583,20 @@ func (d *Diagram) ReComputeGroup(g *Group) {
 		partStartIndex = 0
 	}
 	if partEndIndex == -1 {
-		partEndIndex = len(d.participants)
+		partEndIndex = len(d.participants) - 1
 	}
 
 	endX += CONFIG_MIN_PADDING_X
 	endY += CONFIG_MIN_PADDING_Y
 
 	r := utils.Rect(startX, startY, endX, endY)
-	g.start.primary = d.participants[partStartIndex]
-	g.start.secondary = d.participants[partEndIndex]
-	g.end.primary = d.participants[partStartIndex]
-	g.end.secondary = d.participants[partEndIndex]
+	// an empty group of a diagram without participants has nothing to span.
+	if partEndIndex >= 0 {
+		g.start.primary = d.participants[partStartIndex]
+		g.start.secondary = d.participants[partEndIndex]
+		g.end.primary = d.participants[partStartIndex]
+		g.end.secondary = d.participants[partEndIndex]
+	}
 	g.SetPosition(r)
 
 }
@@ -414,13 +630,21 @@ func (p *Participant) EndProcessAt(s Sequence) *Process {
 		process := obj.(*Process)
 		process.end = s
 		return process
-	} // else if its nil we just ignore it ( TODO: To attach warning to the line.
+	}
+	// nothing to end, the caller raises the warning as it knows the line.
 	return nil
 }
 
 func (d *Diagram) ComputeParticipantSizeAndPlace() error {
+	if len(d.boxes) > 0 {
+		d.dc.Push()
+		d.dc.SetFontFace(d.SequenceFont)
+		_, h := d.dc.MeasureString("Box")
+		d.dc.Pop()
+		d.headerHeight = int(h) + CONFIG_TEXT_PADDING_Y*2 + CONFIG_BOX_PADDING
+	}
 	for idx, p := range d.participants {
-		r := d.MeasureParticipant(p)
+		r := d.MeasureParticipant(p).Add(image.Point{X: 0, Y: d.headerHeight})
 		if r.Dy() > d.participantHeight {
 			d.participantHeight = r.Dy()
 		}
@@ -433,11 +657,21 @@ func (d *Diagram) ComputeParticipantSizeAndPlace() error {
 }
 
 func (d *Diagram) ComputeSequenceMessageAndPlace() error {
-	d.sequenceEndY = CONFIG_MIN_PADDING_Y + d.participantHeight
+	d.sequenceEndY = CONFIG_MIN_PADDING_Y + d.participantHeight + d.headerHeight
 
 	for _, s := range d.sequences {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
 
 		r := s.MeasureBounds(d, d.SequenceFont)
+		if _, ok := s.(*Space); ok {
+			// a space is the whole room between its neighbours, it replaces their padding.
+			r = r.Add(image.Point{X: 0, Y: d.sequenceEndY - CONFIG_MIN_PADDING_Y})
+			s.SetPosition(r)
+			d.sequenceEndY = r.Max.Y
+			continue
+		}
 		r = r.Add(image.Point{X: 0, Y: d.sequenceEndY})
 		s.SetPosition(r)
 		d.sequenceEndY += r.Dy() + CONFIG_MIN_PADDING_Y
@@ -477,43 +711,86 @@ func (d *Diagram) ComputeImageSize() (int, int) {
 
 	imageWidth := lastParticipant.position.Max.X + CONFIG_MIN_PADDING_X
 	imageHeight := d.sequenceEndY + lastParticipant.position.Dy()*2
+	if lastParticipant.box != nil {
+		imageWidth += CONFIG_BOX_PADDING
+	}
+
+	// dividers and delays are centered on the image, make sure their text fits.
+	for _, s := range d.sequences {
+		if s.Type() == ST_DELAY || s.Type() == ST_DIVIDER {
+			if w := s.Position().Dx() + CONFIG_MIN_PADDING_X*2; w > imageWidth {
+				imageWidth = w
+			}
+		}
+	}
 
 	return imageWidth, imageHeight
 
 }
 
 func (d *Diagram) Render(width int, height int) image.Image {
-	d.dc = gg.NewContext(width, height)
+	dc := gg.NewContext(scaled(width, d.scale), scaled(height, d.scale))
+	dc.Scale(d.scale, d.scale)
+	d.RenderTo(dc)
+	return dc.Image()
+}
+
+func scaled(size int, scale float64) int {
+	return int(math.Ceil(float64(size) * scale))
+}
+
+// RenderTo draws the laid out diagram on dc.
+func (d *Diagram) RenderTo(dc Canvas) {
+
+	if d.theme.Background != nil {
+		w, h := d.ComputeImageSize()
+		dc.Push()
+		dc.DrawRectangle(0, 0, float64(w), float64(h))
+		dc.SetColor(d.theme.Background)
+		dc.Fill()
+		dc.Pop()
+	}
+
+	// boxes are the background of their lifelines.
+	for _, b := range d.boxes {
+		d.RenderBox(dc, b)
+	}
 
 	// draw the participants.
 	for _, p := range d.participants {
 		// draws the participants and the top and bottom based on config.
-		d.RenderParticipant(d.dc, p, 0)
+		d.RenderParticipant(dc, p, 0)
 		// draws the dotted lines
-		d.RenderParticipantLines(d.dc, p)
+		d.RenderParticipantLines(dc, p)
 
-		d.RenderParticipant(d.dc, p, d.sequenceEndY)
-		d.RenderProcesses(d.dc, p)
+		d.RenderParticipant(dc, p, d.sequenceEndY-p.position.Min.Y)
+		d.RenderProcesses(dc, p)
 	}
 
 	for _, s := range d.sequences {
-		s.Render(d, d.dc)
+		// Encode returns the error of the context, what is drawn so far is thrown away.
+		if d.ctx.Err() != nil {
+			return
+		}
+		s.Render(d, dc)
 	}
 
 	for _, g := range d.groupList {
-		d.RenderGroup(g)
+		d.RenderGroup(dc, g)
 	}
-
-	return d.dc.Image()
-
 }
 
+// RePlaceParticipants sets the final x of each participant. Parse has already made the
+// participants of a box contiguous, here we only leave room for the box edges.
 func (d *Diagram) RePlaceParticipants() {
 
 	x := CONFIG_MIN_PADDING_X
 
 	for idx, p := range d.participants {
 		if idx == 0 {
+			if p.box != nil {
+				x += CONFIG_BOX_PADDING
+			}
 			nr := p.position.Add(image.Point{X: x, Y: 0})
 			p.position = nr
 
@@ -527,6 +804,15 @@ func (d *Diagram) RePlaceParticipants() {
 			if diffPart > minWidth {
 				minWidth = diffPart
 			}
+			// crossing a box edge needs room for the padding on either side.
+			if prevBox := d.participants[idx-1].box; prevBox != p.box {
+				if prevBox != nil {
+					minWidth += CONFIG_BOX_PADDING
+				}
+				if p.box != nil {
+					minWidth += CONFIG_BOX_PADDING
+				}
+			}
 
 			newX := prevPos.Min.X + prevPos.Dx()/2 + minWidth - p.position.Dx()/2
 			nr := p.position.Add(image.Point{X: newX, Y: 0})
@@ -534,6 +820,7 @@ func (d *Diagram) RePlaceParticipants() {
 		}
 		d.PlaceProcesses(p)
 	}
+	d.PlaceBoxes()
 }
 
 func (d *Diagram) PlaceProcesses(p *Participant) {
@@ -555,11 +842,11 @@ func (d *Diagram) PlaceProcesses(p *Participant) {
 	}
 }
 
-func (d *Diagram) RenderProcesses(dc *gg.Context, p *Participant) {
+func (d *Diagram) RenderProcesses(dc Canvas, p *Participant) {
 	// renders all the processes associated with participant
 	dc.Push()
 	defer dc.Pop()
-	dc.SetColor(CONFIG_PROCESS_LINE_COLOR)
+	dc.SetColor(d.theme.ProcessLine)
 	for _, process := range p.processes {
 		r := process.position
 
@@ -585,18 +872,26 @@ func (d *Diagram) GetProcessAtSequence(p *Participant, sIndex int) *Process {
 	return nil
 }
 
-func (d *Diagram) RenderGroup(g *Group) {
+// GroupFrame is the rectangle drawn around a group, from its left most participant to its right
+// most one or wider when its messages need it.
+func (d *Diagram) GroupFrame(g *Group) utils.Rectangle {
+	x1 := g.start.PrimaryParticipant().position.Min.X
+	w := g.start.SecondaryParticipant().position.Max.X - x1
+	if w < g.position.Dx() {
+		w = g.position.Dx()
+	}
+	return utils.Rect(x1, g.position.Min.Y, x1+w, g.position.Max.Y)
+}
 
-	d.dc.Push()
-	defer d.dc.Pop()
-	d.dc.SetFontFace(d.SequenceFont)
-	d.dc.SetColor(CONFIG_GROUP_LINE_COLOR)
+func (d *Diagram) RenderGroup(dc Canvas, g *Group) {
 
-	x1 := float64(g.start.PrimaryParticipant().position.Min.X)
-	w := float64(g.start.SecondaryParticipant().position.Max.X) - x1
-	if w < float64(g.position.Dx()) {
-		w = float64(g.position.Dx())
-	}
+	dc.Push()
+	defer dc.Pop()
+	dc.SetFontFace(d.SequenceFont)
+	dc.SetColor(d.theme.GroupLine)
+
+	frame := d.GroupFrame(g)
+	x1 := float64(frame.Min.X)
 
 	// group's position as rect is already set before
 	pos := g.Position()
@@ -604,22 +899,22 @@ func (d *Diagram) RenderGroup(g *Group) {
 
 	msgRect := g.MessageRect()
 
-	d.dc.DrawStringWrapped(g.Text(), float64(msgRect.Min.X), float64(msgRect.Min.Y), 1, 1, CONFIG_GROUP_MAX_WIDTH,
+	dc.DrawStringWrapped(g.Text(), float64(msgRect.Min.X), float64(msgRect.Min.Y), 1, 1, CONFIG_GROUP_MAX_WIDTH,
 		CONFIG_MESSAGE_LINE_SPACING, CONFIG_MESSAGE_ALIGN)
 
-	d.dc.DrawRectangle(x1, float64(g.position.Min.Y), float64(w), float64(g.position.Dy()))
-	d.dc.Stroke()
+	dc.DrawRectangle(x1, float64(frame.Min.Y), float64(frame.Dx()), float64(frame.Dy()))
+	dc.Stroke()
 
-	d.dc.MoveTo(x1, float64(pos.Min.Y))
+	dc.MoveTo(x1, float64(pos.Min.Y))
 	// THIS IS YUCK !! please refactor !
-	d.dc.LineTo(x1, float64(pos.Min.Y)+CONFIG_MIN_PADDING_Y)
-	d.dc.LineTo(x1+CONFIG_MIN_PADDING_X, float64(pos.Min.Y)+CONFIG_MIN_PADDING_Y)
-	d.dc.LineTo(x1+CONFIG_MIN_PADDING_X, float64(pos.Min.Y))
-	d.dc.SetColor(CONFIG_GROUP_BG_FILL_COLOR)
-	d.dc.Fill()
-
-	d.dc.SetColor(CONFIG_GROUP_TEXT_COLOR)
-	d.dc.DrawStringAnchored(g.Name(), x1+CONFIG_MIN_PADDING_X/2,
+	dc.LineTo(x1, float64(pos.Min.Y)+CONFIG_MIN_PADDING_Y)
+	dc.LineTo(x1+CONFIG_MIN_PADDING_X, float64(pos.Min.Y)+CONFIG_MIN_PADDING_Y)
+	dc.LineTo(x1+CONFIG_MIN_PADDING_X, float64(pos.Min.Y))
+	dc.SetColor(d.theme.GroupFill)
+	dc.Fill()
+
+	dc.SetColor(d.theme.GroupText)
+	dc.DrawStringAnchored(g.Name(), x1+CONFIG_MIN_PADDING_X/2,
 		float64(pos.Min.Y)+CONFIG_MIN_PADDING_Y/2, 0, 0)
 
 	//// draw the bounds of the group.
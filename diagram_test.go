@@ -1,9 +1,12 @@
 package sequence
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/fogleman/gg"
 	"github.com/stretchr/testify/assert"
 	"go-sequencediagrams/utils"
+	"strings"
 	"testing"
 )
 
@@ -159,6 +162,222 @@ func TestDiagram_AdjustXSpace(t *testing.T) {
 //
 //}
 
+func TestDiagram_ParseWarnings(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	seq := `A ->+ B: Start
+B ->- A: Done
+B ->- A: Again
+end
+loop forever
+A ->+ C: Open`
+	err = d.Parse(seq)
+	assert.NoError(t, err, "Parse gave error !")
+
+	warnings := d.Warnings()
+	assert.Len(t, warnings, 4)
+	assert.Equal(t, 3, warnings[0].Line)
+	assert.Equal(t, 4, warnings[1].Line)
+	assert.Equal(t, 5, warnings[2].Line)
+	assert.Equal(t, 6, warnings[3].Line)
+	for _, w := range warnings {
+		assert.Equal(t, SEVERITY_WARNING, w.Severity)
+	}
+	// the stray end is dropped instead of being added as a sequence, the loop is closed after
+	// the last one.
+	assert.Len(t, d.sequences, 6)
+	if assert.Len(t, d.groupList, 1) {
+		assert.NoError(t, d.Layout())
+		frame := d.GroupFrame(d.groupList[0])
+		assert.True(t, frame.Max.Y >= d.sequences[4].Position().Max.Y, "the loop frames the last message")
+	}
+}
+
+func TestDiagram_WarningsLeaveDiagram(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	// the activation is only found open once every line is read.
+	assert.NoError(t, d.Parse("A ->+ B: a\nC ->- A: b"))
+	raw := append([]Diagnostic{}, d.warnings...)
+	warnings := d.Warnings()
+	if assert.Len(t, warnings, 2) {
+		assert.Equal(t, 1, warnings[0].Line)
+		assert.Equal(t, 2, warnings[1].Line)
+	}
+	assert.Equal(t, raw, d.warnings, "the warnings of the diagram are not reordered")
+}
+
+func TestDiagram_UnclosedEmptyGroup(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("A -> B: hi\nalt never"))
+	assert.Len(t, d.Warnings(), 1)
+	assert.NoError(t, d.Layout())
+	_, err = d.Encode(FORMAT_PNG)
+	assert.NoError(t, err)
+}
+
+func TestDiagram_NotesNotSupported(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	err = d.Parse("A -> B: hi\nnote over A: later")
+	if assert.IsType(t, Diagnostic{}, err) {
+		assert.EqualError(t, err, "line 2: notes are not supported")
+	}
+}
+
+func TestCreateDiagramWithWarnings(t *testing.T) {
+	data, warnings, err := CreateDiagramWithWarnings("A ->+ B: Start")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, 1, warnings[0].Line)
+
+	_, warnings, err = CreateDiagramWithWarnings("A ->+ B: Start\nB ->- A: Done")
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestDiagram_SeparatorsTakeVerticalSpace(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	err = d.Parse("A -> B: one\n...\n== Phase 2 ==\n||45||\nA -> B: two")
+	assert.NoError(t, err, "Parse gave error !")
+	assert.Len(t, d.sequences, 5)
+
+	d.ComputeParticipantSizeAndPlace()
+	d.ComputeSequenceMessageAndPlace()
+
+	// each separator pushes the following sequence down by its own height.
+	prev := d.sequences[0].Position()
+	for _, s := range d.sequences[1:3] {
+		pos := s.Position()
+		assert.Equal(t, prev.Max.Y+CONFIG_MIN_PADDING_Y, pos.Min.Y)
+		prev = pos
+	}
+	assert.Equal(t, CONFIG_DELAY_HEIGHT, d.sequences[1].Position().Dy())
+	// an explicit space is exactly the room between its neighbours.
+	assert.Equal(t, 45, d.sequences[3].Position().Dy())
+	assert.Equal(t, d.sequences[2].Position().Max.Y+45, d.sequences[4].Position().Min.Y)
+}
+
+func TestDiagram_RefSpansParticipants(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	err = d.Parse("A -> B: one\nB -> C: two\nref over C, A : Login flow [[login]]")
+	assert.NoError(t, err, "Parse gave error !")
+
+	d.ComputeParticipantSizeAndPlace()
+	d.ComputeSequenceMessageAndPlace()
+
+	ref := d.sequences[2].(*Ref)
+	assert.Equal(t, "login", ref.Target())
+	assert.Equal(t, d.GetOrCreateParticipant("A"), ref.PrimaryParticipant())
+	assert.Equal(t, d.GetOrCreateParticipant("C"), ref.SecondaryParticipant())
+
+	delta, err := d.GetDelta(0, 2)
+	assert.NoError(t, err)
+	assert.True(t, delta >= ref.Position().Dx(), "participants should be spread to fit the ref")
+}
+
+func TestDiagram_BoxKeepsParticipantsContiguous(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	err = d.Parse(`A -> B: one
+B -> C: two
+box "Backend" #lightblue
+participant A
+participant C
+end box`)
+	assert.NoError(t, err, "Parse gave error !")
+	assert.Empty(t, d.Warnings())
+	assert.Len(t, d.boxes, 1)
+
+	// C moves next to A, B is pushed out of the box.
+	assert.Equal(t, "A", d.participants[0].name)
+	assert.Equal(t, "C", d.participants[1].name)
+	assert.Equal(t, "B", d.participants[2].name)
+	assert.Equal(t, 1, d.participantMap["C"])
+
+	d.ComputeParticipantSizeAndPlace()
+	d.ComputeSequenceMessageAndPlace()
+	d.RePlaceParticipants()
+
+	box := d.boxes[0].Position()
+	assert.Equal(t, d.participants[0].position.Min.X-CONFIG_BOX_PADDING, box.Min.X)
+	assert.Equal(t, d.participants[1].position.Max.X+CONFIG_BOX_PADDING, box.Max.X)
+	assert.True(t, d.participants[2].position.Min.X > box.Max.X, "B should be outside the box")
+	assert.True(t, d.participants[0].position.Min.Y >= d.headerHeight, "label needs room above the participants")
+}
+
+func TestDiagram_BoxWarnings(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	err = d.Parse(`end box
+box "One" #nocolor
+participant A
+box "Two"
+participant A`)
+	assert.NoError(t, err, "Parse gave error !")
+	assert.Len(t, d.Warnings(), 5)
+}
+
+func TestDiagram_ParticipantInfo(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("A -> B: hello\nparticipant B\nB --> A: ok\nB -> C: again\n== done =="))
+	assert.Equal(t, []ParticipantInfo{
+		{Name: "A", Line: 1, Messages: 2},
+		{Name: "B", Line: 2, Declared: true, Messages: 3},
+		{Name: "C", Line: 4, Messages: 1},
+	}, d.ParticipantInfo())
+}
+
+func TestCreateDiagramWithConfigFormats(t *testing.T) {
+	for _, format := range SupportedFormats() {
+		cfg := DefaultConfig()
+		cfg.Format = format
+		data, _, err := CreateDiagramWithConfig("A -> B: hello\nB --> A: back\n", cfg)
+		assert.NoError(t, err, format)
+		assert.NotEmpty(t, data, format)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Format = FORMAT_SVG
+	data, _, err := CreateDiagramWithConfig("A -> B: hello", cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<svg")
+	assert.Contains(t, string(data), ">hello</text>")
+
+	cfg.Format = "bmp"
+	_, _, err = CreateDiagramWithConfig("A -> B: hello", cfg)
+	assert.Error(t, err)
+}
+
+func TestDiagram_ParseErrorLine(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err, "NewDiagram gave error !")
+	err = d.Parse("A -> B: hello\n\nnot a sequence")
+	assert.Error(t, err)
+	dg, ok := err.(Diagnostic)
+	assert.True(t, ok, "parse errors should carry the line")
+	assert.Equal(t, 3, dg.Line)
+	assert.Equal(t, SEVERITY_ERROR, dg.Severity)
+}
+
+func TestFormatFromExtension(t *testing.T) {
+	f, err := FormatFromExtension("docs/login.SVG")
+	assert.NoError(t, err)
+	assert.Equal(t, FORMAT_SVG, f)
+
+	f, err = FormatFromExtension("login.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, FORMAT_JPEG, f)
+
+	_, err = FormatFromExtension("login.seq")
+	assert.Error(t, err)
+}
+
 func BenchmarkCreateDiagramSlow(b *testing.B) {
 	str := `A ->+ B: Start
 A ->+ B: Start
@@ -189,3 +408,96 @@ B->- A : Done`
 	//		_, _ = s.FindPath(fromx , fromy , tox , toy)
 	//	}
 }
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		format string
+		ok     bool
+	}{
+		{"", FORMAT_PNG, true},
+		{"*/*", FORMAT_PNG, true},
+		{"image/svg+xml", FORMAT_SVG, true},
+		{"IMAGE/JPEG", FORMAT_JPEG, true},
+		{"image/png;q=0.1, image/gif;q=0.9", FORMAT_GIF, true},
+		{"text/html, image/*;q=0.5", FORMAT_PNG, true},
+		{"image/svg+xml;q=0, image/png", FORMAT_PNG, true},
+		{"application/json", FORMAT_JSON, true},
+		{"application/pdf", FORMAT_PDF, true},
+		{"text/plain", FORMAT_TXT, true},
+		{"application/xml", "", false},
+		{"image/svg+xml;q=0", "", false},
+	}
+	for _, c := range cases {
+		format, ok := NegotiateFormat(c.accept, FORMAT_PNG)
+		assert.Equal(t, c.ok, ok, c.accept)
+		assert.Equal(t, c.format, format, c.accept)
+	}
+}
+
+func TestNegotiateFormat_ImageWildcard(t *testing.T) {
+	// image/* never gets a format that is not an image.
+	format, ok := NegotiateFormat("image/*", FORMAT_JSON)
+	assert.True(t, ok)
+	assert.Equal(t, FORMAT_PNG, format)
+
+	format, ok = NegotiateFormat("image/*", FORMAT_SVG)
+	assert.True(t, ok)
+	assert.Equal(t, FORMAT_SVG, format)
+
+	format, ok = NegotiateFormat("*/*", FORMAT_JSON)
+	assert.True(t, ok)
+	assert.Equal(t, FORMAT_JSON, format)
+}
+
+func TestDiagram_EncodeText(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("A -> B: hello\nB --> A: ok"))
+	assert.NoError(t, d.Layout())
+	data, err := d.Encode(FORMAT_TXT)
+	assert.NoError(t, err)
+	assert.Equal(t, "A         B\n"+
+		"|         |\n"+
+		"|--hello->|\n"+
+		"|<...ok...|\n"+
+		"|         |\n"+
+		"A         B\n", string(data))
+}
+
+func TestDiagram_EncodeTextStatements(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("A -> B: hi\nalt found\nB -> B: self\nend\n...later...\n== done ==\nref over A, B: login"))
+	assert.NoError(t, d.Layout())
+	data, err := d.Encode(FORMAT_TXT)
+	assert.NoError(t, err)
+	text := string(data)
+	assert.Contains(t, text, "+-- alt found ")
+	assert.Contains(t, text, "|--. self")
+	assert.Contains(t, text, "|<-'")
+	assert.Contains(t, text, ":          :\n   later\n:          :\n")
+	assert.Contains(t, text, "= done =")
+	assert.Contains(t, text, "login")
+
+	columns, rows := d.textSize()
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	assert.Len(t, lines, rows)
+	for _, line := range lines {
+		assert.True(t, len([]rune(line)) <= columns, line)
+	}
+}
+
+func TestDiagram_EncodePDF(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("A -> B: hello"))
+	assert.NoError(t, d.Layout())
+	data, err := d.Encode(FORMAT_PDF)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	w, h := d.ComputeImageSize()
+	assert.Contains(t, string(data), fmt.Sprintf("/MediaBox [0 0 %d %d]", w, h))
+	assert.Equal(t, "application/pdf", ContentType(FORMAT_PDF))
+}
@@ -0,0 +1,213 @@
+package sequence
+
+import "strings"
+
+const (
+	DIFF_EQUAL  = "equal"
+	DIFF_INSERT = "insert"
+	DIFF_DELETE = "delete"
+)
+
+// DIFF_MAX_EDITS bounds the search for the shortest diff of a range, ranges that differ in more
+// lines are replaced as a whole instead. It keeps the time of DiffLines linear in the lines.
+const DIFF_MAX_EDITS = 1000
+
+// DiffLine is one line of a source diff.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines compares two diagram sources line by line with the diff of Myers, which needs memory
+// linear in the number of lines, deletions are listed before the insertions that replace them.
+func DiffLines(from string, to string) []DiffLine {
+	a := splitSourceLines(from)
+	b := splitSourceLines(to)
+
+	// lines are numbered so the diff compares ints instead of strings.
+	ids := map[string]int{}
+	number := func(lines []string) []int {
+		n := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			n[i] = id
+		}
+		return n
+	}
+	ld := lineDiff{a: a, b: b, lines: []DiffLine{}}
+	ld.diff(number(a), number(b), 0, 0)
+	return deletionsFirst(ld.lines)
+}
+
+// lineDiff collects the diff of a and b, the ranges it works on are numbered by DiffLines.
+type lineDiff struct {
+	a     []string
+	b     []string
+	lines []DiffLine
+}
+
+func (ld *lineDiff) equal(i int) {
+	ld.lines = append(ld.lines, DiffLine{Op: DIFF_EQUAL, Text: ld.a[i]})
+}
+
+func (ld *lineDiff) delete(i int) {
+	ld.lines = append(ld.lines, DiffLine{Op: DIFF_DELETE, Text: ld.a[i]})
+}
+
+func (ld *lineDiff) insert(j int) {
+	ld.lines = append(ld.lines, DiffLine{Op: DIFF_INSERT, Text: ld.b[j]})
+}
+
+// deletionsFirst moves the deletions of every run of changes before its insertions.
+func deletionsFirst(lines []DiffLine) []DiffLine {
+	sorted := make([]DiffLine, 0, len(lines))
+	var inserts []DiffLine
+	for _, line := range lines {
+		switch line.Op {
+		case DIFF_DELETE:
+			sorted = append(sorted, line)
+		case DIFF_INSERT:
+			inserts = append(inserts, line)
+		default:
+			sorted = append(append(sorted, inserts...), line)
+			inserts = inserts[:0]
+		}
+	}
+	return append(sorted, inserts...)
+}
+
+// diff compares a and b, the lines at offsets x and y of the sources.
+func (ld *lineDiff) diff(a []int, b []int, x int, y int) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ld.equal(x + prefix)
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	x, y = x+prefix, y+prefix
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if len(a) == 0 || len(b) == 0 {
+		for i := range a {
+			ld.delete(x + i)
+		}
+		for j := range b {
+			ld.insert(y + j)
+		}
+	} else if sx, sy, ok := middleSnake(a, b); ok {
+		ld.diff(a[:sx], b[:sy], x, y)
+		ld.diff(a[sx:], b[sy:], x+sx, y+sy)
+	} else {
+		for i := range a {
+			ld.delete(x + i)
+		}
+		for j := range b {
+			ld.insert(y + j)
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		ld.equal(x + len(a) + i)
+	}
+}
+
+// middleSnake searches the shortest edit script of a and b from both ends at once, where the
+// searches meet splits it in two halves that are diffed on their own. It is the bisect of
+// diff-match-patch, a and b have no common prefix or suffix. It fails when a and b have nothing in
+// common within DIFF_MAX_EDITS edits.
+func middleSnake(a []int, b []int) (int, int, bool) {
+	maxD := (len(a) + len(b) + 1) / 2
+	if maxD > DIFF_MAX_EDITS {
+		maxD = DIFF_MAX_EDITS
+	}
+	offset := maxD
+	// two spare diagonals for the first step of short ranges.
+	v1 := make([]int, 2*maxD+2)
+	v2 := make([]int, 2*maxD+2)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[offset+1] = 0
+	v2[offset+1] = 0
+	delta := len(a) - len(b)
+	// with an odd delta the forward search meets the reverse one, with an even delta the reverse.
+	front := delta%2 != 0
+	// diagonals that ran off the edges are skipped.
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			k1Offset := offset + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[k1Offset-1] < v1[k1Offset+1]) {
+				x1 = v1[k1Offset+1]
+			} else {
+				x1 = v1[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < len(a) && y1 < len(b) && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			v1[k1Offset] = x1
+			if x1 > len(a) {
+				k1end += 2
+			} else if y1 > len(b) {
+				k1start += 2
+			} else if front {
+				k2Offset := offset + delta - k1
+				if k2Offset >= 0 && k2Offset < len(v2) && v2[k2Offset] != -1 {
+					if x1 >= len(a)-v2[k2Offset] {
+						return x1, y1, true
+					}
+				}
+			}
+		}
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			k2Offset := offset + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[k2Offset-1] < v2[k2Offset+1]) {
+				x2 = v2[k2Offset+1]
+			} else {
+				x2 = v2[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < len(a) && y2 < len(b) && a[len(a)-x2-1] == b[len(b)-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Offset] = x2
+			if x2 > len(a) {
+				k2end += 2
+			} else if y2 > len(b) {
+				k2start += 2
+			} else if !front {
+				k1Offset := offset + delta - k2
+				if k1Offset >= 0 && k1Offset < len(v1) && v1[k1Offset] != -1 {
+					x1 := v1[k1Offset]
+					if x1 >= len(a)-x2 {
+						return x1, offset + x1 - k1Offset, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func splitSourceLines(source string) []string {
+	source = strings.Replace(source, "\r\n", "\n", -1)
+	source = strings.TrimSuffix(source, "\n")
+	if len(source) == 0 {
+		return []string{}
+	}
+	return strings.Split(source, "\n")
+}
@@ -0,0 +1,289 @@
+package sequence
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// RegisterEditorHandler serves the browser editor at /. The page is self contained, it only
+// talks to the api of the same server ( live sessions for the preview, the encoded GET
+// route for downloads and links ).
+func RegisterEditorHandler(router *gin.Engine) {
+	router.GET("/", EditorPage)
+}
+
+func EditorPage(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	// nothing outside this server may be loaded.
+	c.Header("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; img-src 'self' data: blob:")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(editorPage))
+}
+
+const editorPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sequence diagram editor</title>
+<style>
+  * { box-sizing: border-box; }
+  body { margin: 0; font-family: sans-serif; display: flex; flex-direction: column; height: 100vh; }
+  header { display: flex; align-items: center; gap: 8px; padding: 6px 10px; border-bottom: 1px solid #ccc; background: #f6f6f6; }
+  header h1 { font-size: 16px; margin: 0 12px 0 0; }
+  header .spacer { flex: 1; }
+  main { flex: 1; display: flex; min-height: 0; }
+  #source-pane { width: 40%; display: flex; flex-direction: column; border-right: 1px solid #ccc; }
+  #editor { flex: 1; display: flex; min-height: 0; font: 13px/18px monospace; }
+  #gutter { width: 40px; overflow: hidden; background: #f0f0f0; color: #999; text-align: right; padding: 4px 4px 4px 0; }
+  #gutter div { height: 18px; }
+  #gutter .error { background: #f8c8c8; color: #900; }
+  #gutter .warning { background: #fbe8b0; color: #850; }
+  #source { flex: 1; border: 0; padding: 4px; resize: none; font: inherit; white-space: pre; outline: none; }
+  #diagnostics { max-height: 30%; overflow: auto; margin: 0; padding: 0; list-style: none; border-top: 1px solid #ccc; font-size: 13px; }
+  #diagnostics li { padding: 3px 8px; cursor: pointer; }
+  #diagnostics li.error { color: #900; }
+  #diagnostics li.warning { color: #850; }
+  #preview { flex: 1; overflow: auto; padding: 16px; text-align: center; }
+  #preview img { max-width: 100%; }
+  #status { font-size: 12px; color: #666; }
+</style>
+</head>
+<body>
+<header>
+  <h1>Sequence diagrams</h1>
+  <span>Download</span>
+  <span id="downloads"></span>
+  <button id="share" type="button">Copy link</button>
+  <span class="spacer"></span>
+  <span id="status">connecting</span>
+</header>
+<main>
+  <section id="source-pane">
+    <div id="editor">
+      <div id="gutter"></div>
+      <textarea id="source" spellcheck="false">participant Alice
+participant Server
+Alice ->+ Server: login
+Server -->- Alice: token</textarea>
+    </div>
+    <ul id="diagnostics"></ul>
+  </section>
+  <section id="preview"></section>
+</main>
+<script>
+(function () {
+  "use strict";
+  var API = "/api/v1/sequence";
+  var FORMATS = ["png", "svg", "jpeg", "gif"];
+  var DEBOUNCE = 250;
+
+  var source = document.getElementById("source");
+  var gutter = document.getElementById("gutter");
+  var list = document.getElementById("diagnostics");
+  var preview = document.getElementById("preview");
+  var status = document.getElementById("status");
+  var downloads = document.getElementById("downloads");
+
+  var session = randomID();
+  var revision = 0;
+  var timer = null;
+  var stream = null;
+
+  function randomID() {
+    var bytes = new Uint8Array(8);
+    window.crypto.getRandomValues(bytes);
+    return Array.prototype.map.call(bytes, function (b) { return ("0" + b.toString(16)).slice(-2); }).join("");
+  }
+
+  // base64url without padding, like the server expects.
+  function base64url(bytes) {
+    var s = "";
+    for (var i = 0; i < bytes.length; i++) { s += String.fromCharCode(bytes[i]); }
+    return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
+  function fromBase64url(s) {
+    s = s.replace(/-/g, "+").replace(/_/g, "/");
+    var bin = atob(s + "===".slice((s.length + 3) % 4));
+    var bytes = new Uint8Array(bin.length);
+    for (var i = 0; i < bin.length; i++) { bytes[i] = bin.charCodeAt(i); }
+    return bytes;
+  }
+
+  // stored deflate blocks, used when the browser can't compress.
+  function deflateStored(data) {
+    var out = [];
+    var pos = 0;
+    do {
+      var n = Math.min(65535, data.length - pos);
+      out.push(pos + n >= data.length ? 1 : 0, n & 255, n >> 8, ~n & 255, (~n >> 8) & 255);
+      for (var i = 0; i < n; i++) { out.push(data[pos + i]); }
+      pos += n;
+    } while (pos < data.length);
+    return new Uint8Array(out);
+  }
+
+  function transform(data, stream) {
+    var s = new Blob([data]).stream().pipeThrough(stream);
+    return new Response(s).arrayBuffer().then(function (b) { return new Uint8Array(b); });
+  }
+
+  function encode(text) {
+    var data = new TextEncoder().encode(text);
+    if (window.CompressionStream) {
+      try {
+        return transform(data, new CompressionStream("deflate-raw")).then(base64url);
+      } catch (e) {}
+    }
+    return Promise.resolve(base64url(deflateStored(data)));
+  }
+
+  function decode(encoded) {
+    if (!window.DecompressionStream) {
+      return Promise.reject(new Error("this browser can't open shared links"));
+    }
+    return transform(fromBase64url(encoded), new DecompressionStream("deflate-raw")).then(function (b) {
+      return new TextDecoder().decode(b);
+    });
+  }
+
+  function renderGutter(diagnostics) {
+    var marks = {};
+    diagnostics.forEach(function (d) {
+      if (d.line > 0 && marks[d.line] !== "error") { marks[d.line] = d.severity; }
+    });
+    var lines = source.value.split("\n").length;
+    gutter.innerHTML = "";
+    for (var i = 1; i <= lines; i++) {
+      var div = document.createElement("div");
+      div.textContent = i;
+      if (marks[i]) { div.className = marks[i]; }
+      gutter.appendChild(div);
+    }
+    gutter.scrollTop = source.scrollTop;
+  }
+
+  function selectLine(line) {
+    var lines = source.value.split("\n");
+    var start = 0;
+    for (var i = 0; i < line - 1 && i < lines.length; i++) { start += lines[i].length + 1; }
+    source.focus();
+    source.setSelectionRange(start, start + (lines[line - 1] || "").length);
+  }
+
+  function renderDiagnostics(diagnostics) {
+    list.innerHTML = "";
+    diagnostics.forEach(function (d) {
+      var li = document.createElement("li");
+      li.className = d.severity;
+      li.textContent = (d.line > 0 ? "line " + d.line + ": " : "") + d.severity + ": " + d.message;
+      li.addEventListener("click", function () { if (d.line > 0) { selectLine(d.line); } });
+      list.appendChild(li);
+    });
+    renderGutter(diagnostics);
+  }
+
+  function showRender(ev) {
+    if (ev.revision !== revision) { return; }
+    var diagnostics = ev.diagnostics || [];
+    if (ev.error && diagnostics.length === 0) {
+      diagnostics = [{severity: "error", line: 0, message: ev.error}];
+    }
+    renderDiagnostics(diagnostics);
+    if (ev.data) {
+      var img = document.createElement("img");
+      img.alt = "diagram";
+      img.src = "data:" + ev.content_type + ";base64," + ev.data;
+      preview.innerHTML = "";
+      preview.appendChild(img);
+      status.textContent = "revision " + ev.revision;
+    } else {
+      status.textContent = "revision " + ev.revision + " has errors";
+    }
+  }
+
+  function updateLinks() {
+    encode(source.value).then(function (encoded) {
+      Array.prototype.forEach.call(downloads.querySelectorAll("a"), function (a) {
+        a.href = API + "/" + a.dataset.format + "/" + encoded;
+      });
+      history.replaceState(null, "", "#" + encoded);
+    });
+  }
+
+  function submit() {
+    revision++;
+    var body = source.value;
+    fetch(API + "/live/" + session + "?format=svg&revision=" + revision, {method: "POST", body: body})
+      .then(function (resp) {
+        if (resp.status === 404) { connect(); }
+        else if (!resp.ok) { status.textContent = "render request failed (" + resp.status + ")"; }
+      })
+      .catch(function () { status.textContent = "server unreachable"; });
+    updateLinks();
+  }
+
+  function schedule() {
+    renderGutter([]);
+    clearTimeout(timer);
+    timer = setTimeout(submit, DEBOUNCE);
+  }
+
+  function connect() {
+    if (stream) { stream.close(); }
+    stream = new EventSource(API + "/live/" + session);
+    stream.addEventListener("ready", function () {
+      status.textContent = "connected";
+      submit();
+    });
+    stream.addEventListener("render", function (e) { showRender(JSON.parse(e.data)); });
+    stream.onerror = function () { status.textContent = "reconnecting"; };
+  }
+
+  FORMATS.forEach(function (format) {
+    var a = document.createElement("a");
+    a.textContent = format;
+    a.dataset.format = format;
+    a.download = "diagram." + format;
+    a.href = "#";
+    downloads.appendChild(a);
+    downloads.appendChild(document.createTextNode(" "));
+  });
+
+  document.getElementById("share").addEventListener("click", function () {
+    encode(source.value).then(function (encoded) {
+      var link = location.origin + API + "/png/" + encoded;
+      var done = function () { status.textContent = "image link copied"; };
+      if (navigator.clipboard) {
+        navigator.clipboard.writeText(link).then(done, function () { prompt("Image link", link); });
+      } else {
+        prompt("Image link", link);
+      }
+    });
+  });
+
+  source.addEventListener("input", schedule);
+  source.addEventListener("scroll", function () { gutter.scrollTop = source.scrollTop; });
+  source.addEventListener("keydown", function (e) {
+    if (e.key === "Tab") {
+      e.preventDefault();
+      var start = source.selectionStart;
+      source.value = source.value.slice(0, start) + "  " + source.value.slice(source.selectionEnd);
+      source.selectionStart = source.selectionEnd = start + 2;
+      schedule();
+    }
+  });
+
+  // #<encoded> opens a shared source.
+  var shared = location.hash.slice(1);
+  var ready = shared ? decode(shared).then(function (text) { source.value = text; }, function (e) {
+    status.textContent = e.message;
+  }) : Promise.resolve();
+  ready.then(function () {
+    renderGutter([]);
+    connect();
+  });
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,32 @@
+package sequence
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEditorPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterEditorHandler(router)
+
+	w := doRequest(router, http.MethodGet, "/", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Security-Policy"), "default-src 'self'")
+	page := w.Body.String()
+	assert.Contains(t, page, API_PREFIX+"/sequence")
+	assert.NotContains(t, page, "http://")
+	assert.NotContains(t, page, "https://")
+
+	// the example the page starts with has to render.
+	start := strings.Index(page, `spellcheck="false">`) + len(`spellcheck="false">`)
+	end := strings.Index(page, "</textarea>")
+	result, err := Validate(page[start:end], DefaultConfig())
+	assert.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Diagnostics)
+}
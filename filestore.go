@@ -0,0 +1,148 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps every revision of a diagram as a json file under root/<tenant>/<id>/<revision>.json
+type FileStore struct {
+	root  string
+	mutex sync.RWMutex
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{root: root}, nil
+}
+
+func (fs *FileStore) dir(tenantID string, id string) string {
+	return filepath.Join(fs.root, tenantID, id)
+}
+
+func (fs *FileStore) path(tenantID string, id string, revision int) string {
+	return filepath.Join(fs.dir(tenantID, id), fmt.Sprintf("%d.json", revision))
+}
+
+// revisions returns the revision numbers on disk in increasing order, callers hold the mutex.
+func (fs *FileStore) revisions(tenantID string, id string) ([]int, error) {
+	if ValidateStoreKey("tenant", tenantID) != nil || ValidateStoreKey("diagram id", id) != nil {
+		return nil, ErrDiagramNotFound
+	}
+	files, err := ioutil.ReadDir(fs.dir(tenantID, id))
+	if os.IsNotExist(err) {
+		return nil, ErrDiagramNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revisions []int
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		revision, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+	if len(revisions) == 0 {
+		return nil, ErrDiagramNotFound
+	}
+	sort.Ints(revisions)
+	return revisions, nil
+}
+
+func (fs *FileStore) read(tenantID string, id string, revision int) (*StoredDiagram, error) {
+	data, err := ioutil.ReadFile(fs.path(tenantID, id, revision))
+	if os.IsNotExist(err) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := StoredDiagram{}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (fs *FileStore) Save(tenantID string, d *StoredDiagram) error {
+	if err := prepareSave(tenantID, d); err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	revisions, err := fs.revisions(tenantID, d.ID)
+	if err != nil && err != ErrDiagramNotFound {
+		return err
+	}
+	d.Revision = 1
+	if len(revisions) > 0 {
+		d.Revision = revisions[len(revisions)-1] + 1
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(fs.dir(tenantID, d.ID), 0755); err != nil {
+		return err
+	}
+	// write and rename so readers never see half a file.
+	path := fs.path(tenantID, d.ID, d.Revision)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (fs *FileStore) Get(tenantID string, id string) (*StoredDiagram, error) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	revisions, err := fs.revisions(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	return fs.read(tenantID, id, revisions[len(revisions)-1])
+}
+
+func (fs *FileStore) GetRevision(tenantID string, id string, revision int) (*StoredDiagram, error) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	if _, err := fs.revisions(tenantID, id); err != nil {
+		return nil, err
+	}
+	return fs.read(tenantID, id, revision)
+}
+
+func (fs *FileStore) Revisions(tenantID string, id string) ([]RevisionInfo, error) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+	revisions, err := fs.revisions(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]RevisionInfo, 0, len(revisions))
+	for _, revision := range revisions {
+		d, err := fs.read(tenantID, id, revision)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, d.Info())
+	}
+	return infos, nil
+}
@@ -0,0 +1,218 @@
+package sequence
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/image/font"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FORMAT_PNG  = "png"
+	FORMAT_SVG  = "svg"
+	FORMAT_JPEG = "jpeg"
+	FORMAT_GIF  = "gif"
+	// the layout of the diagram rather than an image, see DiagramLayout.
+	FORMAT_JSON = "json"
+	// an html <map> of the links of the png, see Diagram.ImageMap.
+	FORMAT_MAP = "map"
+	// the png on a page of its size.
+	FORMAT_PDF = "pdf"
+	// the diagram drawn with characters, see Diagram.Text.
+	FORMAT_TXT = "txt"
+)
+
+var formatContentTypes = map[string]string{
+	FORMAT_PNG:  "image/png",
+	FORMAT_SVG:  "image/svg+xml",
+	FORMAT_JPEG: "image/jpeg",
+	FORMAT_GIF:  "image/gif",
+	FORMAT_JSON: "application/json",
+	FORMAT_MAP:  "text/html; charset=utf-8",
+	FORMAT_PDF:  "application/pdf",
+	FORMAT_TXT:  "text/plain; charset=utf-8",
+}
+
+var formatExtensions = map[string]string{
+	".png":  FORMAT_PNG,
+	".svg":  FORMAT_SVG,
+	".jpg":  FORMAT_JPEG,
+	".jpeg": FORMAT_JPEG,
+	".gif":  FORMAT_GIF,
+	".json": FORMAT_JSON,
+	".html": FORMAT_MAP,
+	".pdf":  FORMAT_PDF,
+	".txt":  FORMAT_TXT,
+}
+
+func SupportedFormats() []string {
+	return []string{FORMAT_PNG, FORMAT_SVG, FORMAT_JPEG, FORMAT_GIF, FORMAT_PDF, FORMAT_TXT, FORMAT_JSON, FORMAT_MAP}
+}
+
+// IsImageFormat is true for the formats served as image/*.
+func IsImageFormat(format string) bool {
+	return strings.HasPrefix(formatContentTypes[format], "image/")
+}
+
+func IsSupportedFormat(format string) bool {
+	_, ok := formatContentTypes[format]
+	return ok
+}
+
+func ContentType(format string) string {
+	return formatContentTypes[format]
+}
+
+// FormatFromContentType is the reverse of ContentType, parameters like the charset don't
+// have to match.
+func FormatFromContentType(contentType string) (string, bool) {
+	for format, ct := range formatContentTypes {
+		if mediaType(ct) == mediaType(contentType) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+}
+
+type acceptedType struct {
+	mediaType string
+	q         float64
+}
+
+// NegotiateFormat picks the output format from an Accept header, */* and an empty header get
+// fallback, image/* gets fallback when it is an image and png otherwise. It fails when none of
+// the accepted types is a supported format.
+func NegotiateFormat(accept string, fallback string) (string, bool) {
+	if len(strings.TrimSpace(accept)) == 0 {
+		return fallback, true
+	}
+	var accepted []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		at := acceptedType{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					at.q = q
+				}
+			}
+		}
+		if len(at.mediaType) > 0 && at.q > 0 {
+			accepted = append(accepted, at)
+		}
+	}
+	// the order of the header breaks ties.
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+	for _, at := range accepted {
+		switch at.mediaType {
+		case "*/*":
+			return fallback, true
+		case "image/*":
+			if IsImageFormat(fallback) {
+				return fallback, true
+			}
+			return FORMAT_PNG, true
+		}
+		// browsers accept text/html for everything, the image map is only asked for by name.
+		if format, ok := FormatFromContentType(at.mediaType); ok && format != FORMAT_MAP {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// FormatFromExtension picks the output format from a file name ( out.svg -> svg ).
+func FormatFromExtension(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	format, ok := formatExtensions[ext]
+	if !ok {
+		return "", fmt.Errorf("Unsupported output extension %s", ext)
+	}
+	return format, nil
+}
+
+// Encode renders the laid out diagram in the given format.
+func (d *Diagram) Encode(format string) ([]byte, error) {
+	// the size of every output is checked before it is built.
+	if format == FORMAT_TXT {
+		if err := d.limits.checkText(d.textSize()); err != nil {
+			return []byte{}, err
+		}
+		return d.Text(), nil
+	}
+	w, h := d.ComputeImageSize()
+	if err := d.limits.checkImage(w, h, d.scale); err != nil {
+		return []byte{}, err
+	}
+
+	switch format {
+	case FORMAT_JSON:
+		return json.Marshal(d.LayoutInfo())
+	case FORMAT_MAP:
+		return d.ImageMap(IMAGE_MAP_NAME), nil
+	}
+
+	if format == FORMAT_SVG {
+		sc := NewSVGCanvas(w, h, map[font.Face]float64{
+			d.SequenceFont:    d.config.SequenceFontSize,
+			d.ParticipantFont: d.config.ParticipantFontSize,
+		})
+		sc.scale = d.scale
+		d.RenderTo(sc)
+		if err := d.ctx.Err(); err != nil {
+			return []byte{}, err
+		}
+		for _, l := range d.Links() {
+			sc.Link(l)
+		}
+		return sc.Bytes(), nil
+	}
+
+	i := d.Render(w, h)
+	if err := d.ctx.Err(); err != nil {
+		return []byte{}, err
+	}
+	buf := new(bytes.Buffer)
+	var err error
+	switch format {
+	case FORMAT_PNG:
+		err = png.Encode(buf, i)
+	case FORMAT_JPEG:
+		err = jpeg.Encode(buf, flatten(i), &jpeg.Options{Quality: 90})
+	case FORMAT_GIF:
+		err = gif.Encode(buf, flatten(i), nil)
+	case FORMAT_PDF:
+		return encodePDF(flatten(i), w, h)
+	default:
+		return []byte{}, fmt.Errorf("Unsupported format %s", format)
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten puts the transparent diagram on a white background for formats without alpha.
+func flatten(i image.Image) image.Image {
+	bg := image.NewRGBA(i.Bounds())
+	draw.Draw(bg, bg.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(bg, bg.Bounds(), i, i.Bounds().Min, draw.Over)
+	return bg
+}
@@ -10,6 +10,7 @@ type Group struct {
 	start    *StartGroupMessage
 	end      *EndGroupMessage
 	position utils.Rectangle
+	line     int
 }
 
 type BaseGroupMessage struct {
@@ -67,7 +68,7 @@ func (bg *BaseGroupMessage) Position() utils.Rectangle {
 	return bg.position
 }
 
-func (bg *BaseGroupMessage) Render(d *Diagram, dc *gg.Context) {
+func (bg *BaseGroupMessage) Render(d *Diagram, dc Canvas) {
 	// we don't render it here.. only done by the main group
 }
 
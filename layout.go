@@ -0,0 +1,175 @@
+package sequence
+
+import (
+	"go-sequencediagrams/utils"
+	"image"
+)
+
+// LayoutRect is a rectangle in image coordinates, the origin is the top left corner.
+type LayoutRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func layoutRect(r utils.Rectangle) LayoutRect {
+	return LayoutRect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// scaled is r in pixels of the image drawn at scale.
+func (r LayoutRect) scaled(scale float64) LayoutRect {
+	x, y := scaled(r.X, scale), scaled(r.Y, scale)
+	return LayoutRect{X: x, Y: y, Width: scaled(r.X+r.Width, scale) - x, Height: scaled(r.Y+r.Height, scale) - y}
+}
+
+// Contains tells if the point x, y is inside the rectangle, for hit testing.
+func (r LayoutRect) Contains(x int, y int) bool {
+	return x >= r.X && x < r.X+r.Width && y >= r.Y && y < r.Y+r.Height
+}
+
+// LayoutLine is the vertical lifeline of a participant.
+type LayoutLine struct {
+	X  int `json:"x"`
+	Y1 int `json:"y1"`
+	Y2 int `json:"y2"`
+}
+
+type ParticipantLayout struct {
+	Name string `json:"name"`
+	Link string `json:"link,omitempty"`
+	// the participant is drawn above and below its lifeline.
+	Top       LayoutRect   `json:"top"`
+	Bottom    LayoutRect   `json:"bottom"`
+	Lifeline  LayoutLine   `json:"lifeline"`
+	Processes []LayoutRect `json:"processes"`
+}
+
+// SequenceLayout is a statement drawn between the participants, From and To are only set for
+// messages.
+type SequenceLayout struct {
+	Index    int        `json:"index"`
+	Type     string     `json:"type"`
+	Text     string     `json:"text,omitempty"`
+	From     string     `json:"from,omitempty"`
+	To       string     `json:"to,omitempty"`
+	Link     string     `json:"link,omitempty"`
+	Position LayoutRect `json:"position"`
+}
+
+type GroupLayout struct {
+	Name  string     `json:"name"`
+	Text  string     `json:"text,omitempty"`
+	Frame LayoutRect `json:"frame"`
+}
+
+type BoxLayout struct {
+	Name     string     `json:"name,omitempty"`
+	Position LayoutRect `json:"position"`
+}
+
+// DiagramLayout is where everything of a diagram is drawn, the json output format.
+type DiagramLayout struct {
+	Width        int                 `json:"width"`
+	Height       int                 `json:"height"`
+	Participants []ParticipantLayout `json:"participants"`
+	Sequences    []SequenceLayout    `json:"sequences"`
+	Groups       []GroupLayout       `json:"groups"`
+	Boxes        []BoxLayout         `json:"boxes"`
+}
+
+// names of the sequence types, the same as the "type" of ParseLine.
+var sequenceTypeNames = map[int]string{
+	ST_SOLID:                "solid",
+	ST_DOTTED:               "dotted",
+	ST_START_PROCESS:        "start_process",
+	ST_END_PROCESS:          "end_process",
+	ST_START_DOTTED_PROCESS: "start_dotted_process",
+	ST_END_DOTTED_PROCESS:   "end_dotted_process",
+	ST_GROUP_MESSAGE:        "group",
+	ST_END_GROUP:            "end",
+	ST_DELAY:                "delay",
+	ST_DIVIDER:              "divider",
+	ST_SPACE:                "space",
+	ST_REF:                  "ref",
+}
+
+// drawnPosition is where s ends up in an image of the given width. Sequences only know their
+// height until they are drawn, separators span the whole image and groups their frame.
+func (d *Diagram) drawnPosition(s Sequence, width int) utils.Rectangle {
+	pos := s.Position()
+	switch seq := s.(type) {
+	case interface {
+		DrawnPosition(d *Diagram) utils.Rectangle
+	}:
+		return seq.DrawnPosition(d)
+	case *StartGroupMessage, *EndGroupMessage:
+		// the frame of the group the start or end belongs to.
+		for _, g := range d.groupList {
+			if Sequence(g.start) == s || Sequence(g.end) == s {
+				frame := d.GroupFrame(g)
+				return utils.Rect(frame.Min.X, pos.Min.Y, frame.Max.X, pos.Max.Y)
+			}
+		}
+	}
+	return utils.Rect(0, pos.Min.Y, width, pos.Max.Y)
+}
+
+// LayoutInfo returns the positions computed by Layout, which has to run first, in pixels of the
+// scaled image like ImageMap.
+func (d *Diagram) LayoutInfo() DiagramLayout {
+	w, h := d.ComputeImageSize()
+	rect := func(r utils.Rectangle) LayoutRect {
+		return layoutRect(r).scaled(d.scale)
+	}
+	l := DiagramLayout{
+		Width:        scaled(w, d.scale),
+		Height:       scaled(h, d.scale),
+		Participants: []ParticipantLayout{},
+		Sequences:    []SequenceLayout{},
+		Groups:       []GroupLayout{},
+		Boxes:        []BoxLayout{},
+	}
+
+	for _, p := range d.participants {
+		rt := p.position
+		pl := ParticipantLayout{
+			Name:   p.name,
+			Link:   p.link,
+			Top:    rect(rt),
+			Bottom: rect(rt.Add(image.Point{X: 0, Y: d.sequenceEndY - rt.Min.Y})),
+			Lifeline: LayoutLine{
+				X:  scaled(rt.Min.X+rt.Dx()/2, d.scale),
+				Y1: scaled(rt.Max.Y, d.scale),
+				Y2: scaled(d.sequenceEndY, d.scale),
+			},
+			Processes: []LayoutRect{},
+		}
+		for _, process := range p.processes {
+			pl.Processes = append(pl.Processes, rect(process.position))
+		}
+		l.Participants = append(l.Participants, pl)
+	}
+
+	for _, s := range d.sequences {
+		sl := SequenceLayout{Index: s.Index(), Type: sequenceTypeNames[s.Type()], Text: s.Text(), Position: rect(d.drawnPosition(s, w))}
+		if IsMessage(s) {
+			sl.From = s.PrimaryParticipant().name
+			sl.To = s.SecondaryParticipant().name
+		}
+		sl.Link = sequenceLink(s)
+		l.Sequences = append(l.Sequences, sl)
+	}
+
+	for _, g := range d.groupList {
+		l.Groups = append(l.Groups, GroupLayout{Name: g.Name(), Text: g.Text(), Frame: rect(d.GroupFrame(g))})
+	}
+
+	for _, b := range d.boxes {
+		if len(b.participants) == 0 {
+			continue
+		}
+		l.Boxes = append(l.Boxes, BoxLayout{Name: b.name, Position: rect(b.position)})
+	}
+	return l
+}
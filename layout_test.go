@@ -0,0 +1,100 @@
+package sequence
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"testing"
+)
+
+func TestLayoutInfo(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("box \"Backend\"\nparticipant B\nend box\nA ->+ B: login\nalt ok\nB -->- A: token\nend\n== done =="))
+	assert.NoError(t, d.Layout())
+	l := d.LayoutInfo()
+
+	w, h := d.ComputeImageSize()
+	assert.Equal(t, w, l.Width)
+	assert.Equal(t, h, l.Height)
+
+	if assert.Len(t, l.Participants, 2) {
+		b := l.Participants[0]
+		assert.Equal(t, "B", b.Name)
+		assert.Equal(t, b.Top.X+b.Top.Width/2, b.Lifeline.X)
+		assert.Equal(t, b.Top.Y+b.Top.Height, b.Lifeline.Y1)
+		assert.Equal(t, b.Lifeline.Y2, b.Bottom.Y)
+		assert.Equal(t, b.Top.Width, b.Bottom.Width)
+		if assert.Len(t, b.Processes, 1) {
+			assert.True(t, b.Processes[0].Contains(b.Lifeline.X, b.Processes[0].Y), "the activation is on the lifeline")
+		}
+		assert.Empty(t, l.Participants[1].Processes)
+	}
+
+	if assert.Len(t, l.Sequences, 5) {
+		assert.Equal(t, SequenceLayout{Index: 0, Type: "start_process", Text: "login", From: "A", To: "B", Position: l.Sequences[0].Position}, l.Sequences[0])
+		assert.Equal(t, "group", l.Sequences[1].Type)
+		assert.Equal(t, "divider", l.Sequences[4].Type)
+		assert.Empty(t, l.Sequences[4].From)
+		// the login arrow runs from the lifeline of A to the activation it starts on B.
+		login := l.Sequences[0].Position
+		assert.Equal(t, l.Participants[0].Processes[0].X+l.Participants[0].Processes[0].Width, login.X)
+		assert.Equal(t, l.Participants[1].Lifeline.X, login.X+login.Width)
+		assert.Equal(t, LayoutRect{X: 0, Y: l.Sequences[4].Position.Y, Width: l.Width, Height: l.Sequences[4].Position.Height}, l.Sequences[4].Position)
+		for i := 1; i < len(l.Sequences); i++ {
+			assert.True(t, l.Sequences[i].Position.Y > l.Sequences[i-1].Position.Y, "sequences go down the diagram")
+		}
+	}
+
+	if assert.Len(t, l.Groups, 1) {
+		frame := l.Groups[0].Frame
+		assert.Equal(t, "alt", l.Groups[0].Name)
+		token := l.Sequences[2].Position
+		assert.True(t, frame.Contains(token.X, token.Y), "the group frames its messages")
+	}
+	if assert.Len(t, l.Boxes, 1) {
+		assert.Equal(t, "Backend", l.Boxes[0].Name)
+		top := l.Participants[0].Top
+		assert.True(t, l.Boxes[0].Position.Contains(top.X, top.Y))
+	}
+
+	cfg := DefaultConfig()
+	cfg.Format = FORMAT_JSON
+	data, _, err := CreateDiagramWithConfig("A -> B: hello", cfg)
+	assert.NoError(t, err)
+	var decoded DiagramLayout
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Len(t, decoded.Participants, 2)
+	assert.Len(t, decoded.Sequences, 1)
+}
+
+func TestLayoutInfoScaled(t *testing.T) {
+	source := "A -> B: hello\n== done =="
+	r, err := NewRenderer()
+	assert.NoError(t, err)
+	d := r.NewDiagram()
+	assert.NoError(t, d.Parse(source))
+	assert.NoError(t, d.Layout())
+	l := d.LayoutInfo()
+
+	r, err = NewRenderer(WithScale(2))
+	assert.NoError(t, err)
+	d = r.NewDiagram()
+	assert.NoError(t, d.Parse(source))
+	assert.NoError(t, d.Layout())
+	scaledLayout := d.LayoutInfo()
+
+	// the layout is in pixels of the image it goes with.
+	data, _, err := r.Render(source)
+	assert.NoError(t, err)
+	i, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, i.Bounds().Dx(), scaledLayout.Width)
+	assert.Equal(t, i.Bounds().Dy(), scaledLayout.Height)
+	assert.Equal(t, 2*l.Width, scaledLayout.Width)
+	assert.Equal(t, 2*l.Participants[1].Lifeline.X, scaledLayout.Participants[1].Lifeline.X)
+	assert.Equal(t, LayoutRect{X: 2 * l.Participants[0].Top.X, Y: 2 * l.Participants[0].Top.Y,
+		Width: 2 * l.Participants[0].Top.Width, Height: 2 * l.Participants[0].Top.Height}, scaledLayout.Participants[0].Top)
+	assert.Equal(t, scaledLayout.Width, scaledLayout.Sequences[1].Position.Width)
+}
@@ -0,0 +1,103 @@
+package sequence
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Limits bound what a Renderer accepts, zero means no limit.
+type Limits struct {
+	MaxSourceBytes   int `json:"max_source_bytes"`
+	MaxLines         int `json:"max_lines"`
+	MaxParticipants  int `json:"max_participants"`
+	MaxMessageLength int `json:"max_message_length"`
+	// width * height of the scaled image, what the png, jpeg and gif output allocates.
+	MaxImagePixels int `json:"max_image_pixels"`
+	// columns * rows of the text output.
+	MaxTextCells int `json:"max_text_cells"`
+}
+
+// DefaultLimits keep a single render of the api within a few hundred megabytes and seconds.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxSourceBytes:   1 << 20,
+		MaxLines:         10000,
+		MaxParticipants:  100,
+		MaxMessageLength: 1000,
+		MaxImagePixels:   50 * 1000 * 1000,
+		MaxTextCells:     10 * 1000 * 1000,
+	}
+}
+
+const (
+	LIMIT_SOURCE_BYTES   = "source_bytes"
+	LIMIT_LINES          = "lines"
+	LIMIT_PARTICIPANTS   = "participants"
+	LIMIT_MESSAGE_LENGTH = "message_length"
+	LIMIT_IMAGE_PIXELS   = "image_pixels"
+	LIMIT_TEXT_CELLS     = "text_cells"
+)
+
+// LimitError is returned when a diagram goes over one of its Limits, Line is 0 when the limit
+// isn't about a line of the source.
+type LimitError struct {
+	Limit string `json:"limit"`
+	Max   int    `json:"max"`
+	Line  int    `json:"line,omitempty"`
+}
+
+var limitMessages = map[string]string{
+	LIMIT_SOURCE_BYTES:   "Sequence is larger than %d bytes",
+	LIMIT_LINES:          "Sequence has more than %d lines",
+	LIMIT_PARTICIPANTS:   "More than %d participants",
+	LIMIT_MESSAGE_LENGTH: "Text is longer than %d characters",
+	LIMIT_IMAGE_PIXELS:   "Image is larger than %d pixels",
+	LIMIT_TEXT_CELLS:     "Text output is larger than %d characters",
+}
+
+func (e LimitError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.message())
+	}
+	return e.message()
+}
+
+func (e LimitError) message() string {
+	return fmt.Sprintf(limitMessages[e.Limit], e.Max)
+}
+
+// checkSource is checked before parsing, lines counts the blank ones too.
+func (l Limits) checkSource(source string, lines int) error {
+	if l.MaxSourceBytes > 0 && len(source) > l.MaxSourceBytes {
+		return LimitError{Limit: LIMIT_SOURCE_BYTES, Max: l.MaxSourceBytes}
+	}
+	if l.MaxLines > 0 && lines > l.MaxLines {
+		return LimitError{Limit: LIMIT_LINES, Max: l.MaxLines}
+	}
+	return nil
+}
+
+// checkStatement is checked once a statement is added.
+func (l Limits) checkStatement(d *Diagram, seq map[string]interface{}, lineNo int) error {
+	if text, ok := seq["text"].(string); ok && l.MaxMessageLength > 0 && utf8.RuneCountInString(text) > l.MaxMessageLength {
+		return LimitError{Limit: LIMIT_MESSAGE_LENGTH, Max: l.MaxMessageLength, Line: lineNo}
+	}
+	if l.MaxParticipants > 0 && len(d.participants) > l.MaxParticipants {
+		return LimitError{Limit: LIMIT_PARTICIPANTS, Max: l.MaxParticipants, Line: lineNo}
+	}
+	return nil
+}
+
+func (l Limits) checkImage(width int, height int, scale float64) error {
+	if l.MaxImagePixels > 0 && scaled(width, scale)*scaled(height, scale) > l.MaxImagePixels {
+		return LimitError{Limit: LIMIT_IMAGE_PIXELS, Max: l.MaxImagePixels}
+	}
+	return nil
+}
+
+func (l Limits) checkText(columns int, rows int) error {
+	if l.MaxTextCells > 0 && columns*rows > l.MaxTextCells {
+		return LimitError{Limit: LIMIT_TEXT_CELLS, Max: l.MaxTextCells}
+	}
+	return nil
+}
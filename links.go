@@ -0,0 +1,95 @@
+package sequence
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// IMAGE_MAP_NAME is the name of the <map> of the map output format, images use it with
+// usemap="#sequence-diagram".
+const IMAGE_MAP_NAME = "sequence-diagram"
+
+// links end up in svg and html served by the api, anything that could run script is refused.
+var linkSchemes = map[string]bool{
+	"":       true,
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// ValidateLink checks the [[url]] of a participant, message or ref, only http, https, mailto
+// and relative urls are allowed.
+func ValidateLink(link string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("Invalid link %s", link)
+	}
+	if !linkSchemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("Unsupported link scheme %s, use http, https or mailto", u.Scheme)
+	}
+	return nil
+}
+
+// Link is a clickable area of the diagram.
+type Link struct {
+	Href  string     `json:"href"`
+	Title string     `json:"title"`
+	Area  LayoutRect `json:"area"`
+}
+
+// Links lists the areas of linked participants ( top and bottom ), messages and refs with a
+// target, Layout has to run first.
+func (d *Diagram) Links() []Link {
+	links := []Link{}
+	for _, p := range d.participants {
+		if len(p.link) == 0 {
+			continue
+		}
+		top := layoutRect(p.position)
+		bottom := top
+		bottom.Y = d.sequenceEndY
+		links = append(links, Link{Href: p.link, Title: p.name, Area: top}, Link{Href: p.link, Title: p.name, Area: bottom})
+	}
+	for _, s := range d.sequences {
+		if link := sequenceLink(s); len(link) > 0 {
+			links = append(links, Link{Href: link, Title: s.Text(), Area: layoutRect(d.drawnPosition(s, 0))})
+		}
+	}
+	return links
+}
+
+func sequenceLink(s Sequence) string {
+	if l, ok := s.(interface{ Link() string }); ok {
+		return l.Link()
+	}
+	return ""
+}
+
+// Link is the url the message links to, empty without one.
+func (s *BaseSequence) Link() string {
+	return s.link
+}
+
+// ImageMap is an html <map> of the links of the diagram for the png output, in pixels of the
+// scaled image.
+func (d *Diagram) ImageMap(name string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "<map name=\"%s\">\n", html.EscapeString(name))
+	for _, l := range d.Links() {
+		a := l.Area.scaled(d.scale)
+		fmt.Fprintf(buf, "  <area shape=\"rect\" coords=\"%d,%d,%d,%d\" href=\"%s\" alt=\"%s\" title=\"%s\">\n",
+			a.X, a.Y, a.X+a.Width, a.Y+a.Height, html.EscapeString(l.Href), html.EscapeString(l.Title), html.EscapeString(l.Title))
+	}
+	buf.WriteString("</map>\n")
+	return buf.Bytes()
+}
+
+// Link makes an area of the svg clickable, an invisible rectangle drawn over what is there.
+func (sc *SVGCanvas) Link(l Link) {
+	a := l.Area
+	fmt.Fprintf(&sc.body, `<a href="%s"><title>%s</title><rect x="%d" y="%d" width="%d" height="%d" fill="#ffffff" fill-opacity="0"/></a>`+"\n",
+		html.EscapeString(l.Href), html.EscapeString(l.Title), a.X, a.Y, a.Width, a.Height)
+}
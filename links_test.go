@@ -0,0 +1,109 @@
+package sequence
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	output, typ, err := ParseLine("participant Auth [[https://docs.example.com/auth]]")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_PARTICIPANT, typ)
+	assert.JSONEq(t, `{"type":"participant", "name": "Auth", "link": "https://docs.example.com/auth"}`, output)
+
+	output, typ, err = ParseLine("A -->+ Auth: call it [[/code/auth.go#L12]]")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_START_DOTTED_PROCESS, typ)
+	var seq map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(output), &seq))
+	assert.Equal(t, "/code/auth.go#L12", seq["link"])
+
+	_, _, err = ParseLine(`A -> B: hi [[http://x/"]]`)
+	assert.Error(t, err, "quotes can't be in a link")
+	_, _, err = ParseLine("A -> B: hi [[http://x/ y]]")
+	assert.Error(t, err)
+
+	assert.NoError(t, ValidateLink("https://example.com/a?b=c"))
+	assert.NoError(t, ValidateLink("mailto:team@example.com"))
+	assert.NoError(t, ValidateLink("../auth"))
+	assert.EqualError(t, ValidateLink("javascript:alert(1)"), "Unsupported link scheme javascript, use http, https or mailto")
+}
+
+func TestLinks(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse("participant Auth [[https://docs.example.com/auth]]\nA -> Auth: login [[https://code.example.com/login?a=1&b=2]]\nAuth -> A: ok\nA -> Auth: bad [[javascript:alert(1)]]"))
+	assert.NoError(t, d.Layout())
+
+	if assert.Len(t, d.Warnings(), 1) {
+		assert.Equal(t, 4, d.Warnings()[0].Line)
+	}
+	assert.Equal(t, "login", d.sequences[0].Text(), "the space before the link isn't text")
+
+	l := d.LayoutInfo()
+	links := d.Links()
+	if assert.Len(t, links, 3) {
+		assert.Equal(t, Link{Href: "https://docs.example.com/auth", Title: "Auth", Area: l.Participants[0].Top}, links[0])
+		assert.Equal(t, l.Participants[0].Bottom, links[1].Area)
+		assert.Equal(t, Link{Href: "https://code.example.com/login?a=1&b=2", Title: "login", Area: l.Sequences[0].Position}, links[2])
+	}
+	assert.Equal(t, "https://docs.example.com/auth", l.Participants[0].Link)
+	assert.Empty(t, l.Sequences[2].Link)
+
+	m := string(d.ImageMap(IMAGE_MAP_NAME))
+	assert.True(t, strings.HasPrefix(m, `<map name="sequence-diagram">`))
+	assert.Equal(t, 3, strings.Count(m, "<area "))
+	a := links[2].Area
+	assert.Contains(t, m, `coords="`+strings.Join([]string{strconv.Itoa(a.X), strconv.Itoa(a.Y), strconv.Itoa(a.X + a.Width), strconv.Itoa(a.Y + a.Height)}, ",")+`" href="https://code.example.com/login?a=1&amp;b=2"`)
+
+	svg, err := d.Encode(FORMAT_SVG)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(svg), "<a href="))
+	assert.NotContains(t, string(svg), "javascript")
+
+	// links survive formatting and the json document.
+	src := "participant Auth   [[https://docs.example.com/auth]]\nA->Auth:login [[/login]]\n"
+	formatted := FormatSource(src)
+	assert.Equal(t, "participant Auth [[https://docs.example.com/auth]]\nA -> Auth: login [[/login]]\n", formatted)
+	doc, err := MarshalDiagram(mustParse(t, formatted))
+	assert.NoError(t, err)
+	again, err := UnmarshalDiagram(doc, DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "/login", again.sequences[0].(*SolidSequence).Link())
+	assert.Equal(t, "https://docs.example.com/auth", again.participants[0].link)
+}
+
+func TestRefLinks(t *testing.T) {
+	d := mustParse(t, "A -> B: hi\nref over A, B: Login flow [[login]]\nref over B: Bad [[javascript:alert(1)]]")
+	assert.Len(t, d.Warnings(), 1)
+	assert.NoError(t, d.Layout())
+	links := d.Links()
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, Link{Href: "login", Title: "Login flow", Area: layoutRect(d.sequences[1].(*Ref).DrawnPosition(d))}, links[0])
+	}
+	svg, err := d.Encode(FORMAT_SVG)
+	assert.NoError(t, err)
+	assert.Contains(t, string(svg), `<a href="login">`)
+}
+
+func TestImageMapFormat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Format = FORMAT_MAP
+	data, _, err := CreateDiagramWithConfig("A -> B: hello [[https://example.com]]", cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `href="https://example.com"`)
+	assert.Equal(t, "text/html; charset=utf-8", ContentType(FORMAT_MAP))
+
+	format, ok := NegotiateFormat("text/html", FORMAT_PNG)
+	assert.False(t, ok, "the map is never negotiated, got %s", format)
+}
+
+func mustParse(t *testing.T, source string) *Diagram {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse(source))
+	return d
+}
@@ -0,0 +1,259 @@
+package sequence
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LIVE_PING_INTERVAL keeps idle live streams from being closed by proxies.
+const LIVE_PING_INTERVAL = 15 * time.Second
+
+var ErrNoLiveSession = fmt.Errorf("No live session, open the event stream first")
+var ErrStaleRevision = fmt.Errorf("A newer revision was already submitted")
+
+// LiveEvent is pushed to the subscribers of a live session for every rendered revision.
+type LiveEvent struct {
+	Revision    int          `json:"revision"`
+	Format      string       `json:"format"`
+	ContentType string       `json:"content_type,omitempty"`
+	Data        []byte       `json:"data,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type liveRequest struct {
+	revision int
+	source   string
+	cfg      Config
+}
+
+// LiveRenderFunc renders a revision of a live session, ctx is cancelled once a newer revision
+// is submitted or the last subscriber goes away.
+type LiveRenderFunc func(ctx context.Context, source string, cfg Config) ([]byte, []Diagnostic, error)
+
+// liveSession renders the revisions submitted by an editor, only the latest one counts. While
+// a render runs newer revisions replace the pending one and cancel the running render, whose
+// result is dropped.
+type liveSession struct {
+	mutex       sync.Mutex
+	subscribers map[chan LiveEvent]bool
+	latest      int
+	pending     *liveRequest
+	rendering   bool
+	// cancels the running render.
+	cancel context.CancelFunc
+	last   *LiveEvent
+}
+
+// LiveHub keeps the live sessions of the server, a session lives as long as it has subscribers.
+type LiveHub struct {
+	mutex    sync.Mutex
+	sessions map[string]*liveSession
+	render   LiveRenderFunc
+}
+
+func NewLiveHub(render LiveRenderFunc) *LiveHub {
+	return &LiveHub{sessions: make(map[string]*liveSession), render: render}
+}
+
+// Subscribe returns the events of a session, starting with the last render if there is one.
+// The returned func has to be called once the subscriber goes away.
+func (lh *LiveHub) Subscribe(id string) (<-chan LiveEvent, func()) {
+	lh.mutex.Lock()
+	defer lh.mutex.Unlock()
+	s, ok := lh.sessions[id]
+	if !ok {
+		s = &liveSession{subscribers: make(map[chan LiveEvent]bool)}
+		lh.sessions[id] = s
+	}
+
+	// a slow subscriber only ever misses intermediate revisions.
+	events := make(chan LiveEvent, 1)
+	s.mutex.Lock()
+	s.subscribers[events] = true
+	if s.last != nil {
+		events <- *s.last
+	}
+	s.mutex.Unlock()
+
+	return events, func() {
+		lh.mutex.Lock()
+		defer lh.mutex.Unlock()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.subscribers, events)
+		if len(s.subscribers) == 0 && lh.sessions[id] == s {
+			delete(lh.sessions, id)
+			// nobody is left to see the render.
+			s.pending = nil
+			if s.cancel != nil {
+				s.cancel()
+			}
+		}
+	}
+}
+
+// Submit queues a revision of the source for rendering and cancels the render of an older one,
+// revision 0 means the one after the latest. Revisions older than the latest are rejected with
+// ErrStaleRevision.
+func (lh *LiveHub) Submit(id string, revision int, source string, cfg Config) (int, error) {
+	lh.mutex.Lock()
+	s, ok := lh.sessions[id]
+	lh.mutex.Unlock()
+	if !ok {
+		return 0, ErrNoLiveSession
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if revision == 0 {
+		revision = s.latest + 1
+	}
+	if revision <= s.latest {
+		return revision, ErrStaleRevision
+	}
+	s.latest = revision
+	s.pending = &liveRequest{revision: revision, source: source, cfg: cfg}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if !s.rendering {
+		s.rendering = true
+		go s.run(lh.render)
+	}
+	return revision, nil
+}
+
+// run renders pending revisions until there are none left.
+func (s *liveSession) run(render LiveRenderFunc) {
+	for {
+		s.mutex.Lock()
+		req := s.pending
+		s.pending = nil
+		if req == nil {
+			s.rendering = false
+			s.mutex.Unlock()
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.mutex.Unlock()
+
+		ev := LiveEvent{Revision: req.revision, Format: req.cfg.Format, Diagnostics: []Diagnostic{}}
+		data, warnings, err := render(ctx, req.source, req.cfg)
+		cancel()
+		if err != nil {
+			ev.Error = err.Error()
+			if dg, ok := err.(Diagnostic); ok {
+				ev.Diagnostics = append(ev.Diagnostics, dg)
+			}
+		} else {
+			ev.ContentType = ContentType(req.cfg.Format)
+			ev.Data = data
+			ev.Diagnostics = append(ev.Diagnostics, warnings...)
+		}
+
+		s.mutex.Lock()
+		s.cancel = nil
+		if req.revision == s.latest {
+			s.last = &ev
+			s.broadcast(ev)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// broadcast replaces whatever a subscriber has not read yet with ev, callers hold the mutex.
+func (s *liveSession) broadcast(ev LiveEvent) {
+	for events := range s.subscribers {
+		select {
+		case <-events:
+		default:
+		}
+		events <- ev
+	}
+}
+
+// liveSessionKey scopes the session id of the url to the user and tenant of the request, so
+// sessions of others can't be watched or written to by guessing their id. Anonymous requests
+// share one scope per tenant, which is only named by the client without authentication.
+func (u *GinSequenceHandler) liveSessionKey(c *gin.Context, id string) string {
+	// live sessions don't need a tenant, a missing one is a scope of its own.
+	tenant, _ := RequestTenant(c, u.authenticated)
+	return fmt.Sprintf("%q %q %q", RequestAuthor(c), tenant, id)
+}
+
+// LiveStream sends the renders of a live session as server-sent events
+// ( GET /sequence/live/:session ), a "render" event carries a LiveEvent.
+func (u *GinSequenceHandler) LiveStream(c *gin.Context) {
+	id := c.Param("sub")
+	if err := ValidateStoreKey("live session", id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, unsubscribe := u.live.Subscribe(u.liveSessionKey(c, id))
+	defer unsubscribe()
+
+	ping := time.NewTicker(LIVE_PING_INTERVAL)
+	defer ping.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", id)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-events:
+			c.SSEvent("render", ev)
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+// LiveSubmit takes a revision of the source for a live session ( POST
+// /sequence/live/:session?revision=3&format=svg ), the render arrives on the event stream.
+func (u *GinSequenceHandler) LiveSubmit(c *gin.Context) {
+	id := c.Param("sub")
+	if err := ValidateStoreKey("live session", id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	revision := 0
+	if s, ok := c.GetQuery("revision"); ok {
+		r, err := ParseRevision(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		revision = r
+	}
+	cfg, ok := u.negotiate(c)
+	if !ok {
+		return
+	}
+	source, err := requestSource(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	revision, err = u.live.Submit(u.liveSessionKey(c, id), revision, source, cfg)
+	switch err {
+	case nil:
+		c.JSON(http.StatusAccepted, gin.H{"revision": revision})
+	case ErrNoLiveSession:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case ErrStaleRevision:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "revision": revision})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
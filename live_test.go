@@ -0,0 +1,158 @@
+package sequence
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveHubDropsStaleRevisions(t *testing.T) {
+	started := make(chan string)
+	release := make(chan bool)
+	cancelled := make(chan string)
+	hub := NewLiveHub(func(ctx context.Context, source string, cfg Config) ([]byte, []Diagnostic, error) {
+		started <- source
+		select {
+		case <-release:
+		case <-ctx.Done():
+			cancelled <- source
+			return nil, nil, ctx.Err()
+		}
+		return []byte(source), nil, nil
+	})
+
+	_, err := hub.Submit("s1", 1, "A -> B: one", DefaultConfig())
+	assert.Equal(t, ErrNoLiveSession, err)
+
+	events, unsubscribe := hub.Subscribe("s1")
+	defer unsubscribe()
+
+	_, err = hub.Submit("s1", 1, "A -> B: one", DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "A -> B: one", <-started)
+
+	// revisions arriving during the render replace each other, the running one is cancelled.
+	_, err = hub.Submit("s1", 2, "A -> B: two", DefaultConfig())
+	assert.NoError(t, err)
+	revision, err := hub.Submit("s1", 0, "A -> B: three", DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, revision)
+	_, err = hub.Submit("s1", 2, "A -> B: late", DefaultConfig())
+	assert.Equal(t, ErrStaleRevision, err)
+
+	assert.Equal(t, "A -> B: one", <-cancelled)
+	assert.Equal(t, "A -> B: three", <-started)
+	release <- true
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, 3, ev.Revision)
+		assert.Equal(t, "A -> B: three", string(ev.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no render")
+	}
+
+	// a late subscriber starts with the last render.
+	late, unsubscribeLate := hub.Subscribe("s1")
+	assert.Equal(t, 3, (<-late).Revision)
+	unsubscribeLate()
+}
+
+func TestLiveHubCancelsWithoutSubscribers(t *testing.T) {
+	started := make(chan bool)
+	done := make(chan error)
+	hub := NewLiveHub(func(ctx context.Context, source string, cfg Config) ([]byte, []Diagnostic, error) {
+		started <- true
+		<-ctx.Done()
+		done <- ctx.Err()
+		return nil, nil, ctx.Err()
+	})
+	_, unsubscribe := hub.Subscribe("s1")
+	_, err := hub.Submit("s1", 0, "A -> B: one", DefaultConfig())
+	assert.NoError(t, err)
+	<-started
+	unsubscribe()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("render not cancelled")
+	}
+}
+
+func TestSequenceHandlerLive(t *testing.T) {
+	server := httptest.NewServer(testRouter(nil, DefaultHandlerConfig()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/sequence/live/editor1")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	lines := bufio.NewReader(resp.Body)
+
+	// next returns the data of the next event named name.
+	next := func(name string) string {
+		event := ""
+		for {
+			line, err := lines.ReadString('\n')
+			if !assert.NoError(t, err) {
+				return ""
+			}
+			line = strings.TrimRight(line, "\n")
+			if strings.HasPrefix(line, "event:") {
+				event = line[len("event:"):]
+			}
+			if strings.HasPrefix(line, "data:") && event == name {
+				return line[len("data:"):]
+			}
+		}
+	}
+	assert.Equal(t, "editor1", next("ready"))
+
+	post, err := http.Post(server.URL+"/api/v1/sequence/live/editor1?revision=1&format=svg", "text/plain", strings.NewReader("A ->+ B: hello"))
+	assert.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusAccepted, post.StatusCode)
+
+	var ev LiveEvent
+	assert.NoError(t, json.Unmarshal([]byte(next("render")), &ev))
+	assert.Equal(t, 1, ev.Revision)
+	assert.Equal(t, "image/svg+xml", ev.ContentType)
+	assert.Contains(t, string(ev.Data), "<svg")
+	assert.Len(t, ev.Diagnostics, 1)
+
+	post, err = http.Post(server.URL+"/api/v1/sequence/live/editor1", "text/plain", strings.NewReader("A -> B: hello\nnot valid"))
+	assert.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusAccepted, post.StatusCode)
+	ev = LiveEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(next("render")), &ev))
+	assert.Equal(t, 2, ev.Revision)
+	assert.NotEmpty(t, ev.Error)
+	assert.Empty(t, ev.Data)
+
+	post, err = http.Post(server.URL+"/api/v1/sequence/live/editor1?revision=1", "text/plain", strings.NewReader("A -> B: hello"))
+	assert.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusConflict, post.StatusCode)
+
+	post, err = http.Post(server.URL+"/api/v1/sequence/live/nobody", "text/plain", strings.NewReader("A -> B: hello"))
+	assert.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusNotFound, post.StatusCode)
+
+	// the same session id of another tenant is another session.
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/sequence/live/editor1", strings.NewReader("A -> B: hello"))
+	assert.NoError(t, err)
+	req.Header.Set("tenantID", "other")
+	post, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusNotFound, post.StatusCode)
+}
@@ -1 +1,480 @@
 package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+)
+
+// DOCUMENT_VERSION is the version of the json schema of Document, documents of another version
+// are rejected.
+const DOCUMENT_VERSION = 1
+
+// element types of a Document.
+const (
+	ELEMENT_MESSAGE = "message"
+	ELEMENT_GROUP   = "group"
+	ELEMENT_REF     = "ref"
+	ELEMENT_DELAY   = "delay"
+	ELEMENT_DIVIDER = "divider"
+	ELEMENT_SPACE   = "space"
+)
+
+const (
+	ARROW_SOLID  = "solid"
+	ARROW_DOTTED = "dotted"
+
+	ACTIVATION_START = "activate"
+	ACTIVATION_END   = "deactivate"
+)
+
+// Document is the json representation of a diagram for tools that build or read diagrams
+// without going through the source syntax:
+//
+//	{"version": 1, "participants": [{"name": "A"}, {"name": "B"}],
+//	 "elements": [{"type": "message", "from": "A", "to": "B", "text": "hello", "activation": "activate"}]}
+//
+// Texts are used as they are, like those of a Builder. Only documents whose texts fit the
+// source syntax can be written as Source. Notes are out of scope: they are neither drawn nor
+// part of the schema, and documents with notes are refused like sources with them.
+type Document struct {
+	Version int `json:"version"`
+	// in the order they are drawn.
+	Participants []DocumentParticipant `json:"participants"`
+	Boxes        []DocumentBox         `json:"boxes,omitempty"`
+	Elements     []DocumentElement     `json:"elements"`
+}
+
+type DocumentParticipant struct {
+	Name string `json:"name"`
+	Link string `json:"link,omitempty"`
+}
+
+type DocumentBox struct {
+	Name string `json:"name,omitempty"`
+	// a color name or #rrggbb, the default fill when empty.
+	Color        string   `json:"color,omitempty"`
+	Participants []string `json:"participants"`
+}
+
+// DocumentElement is a statement of the diagram, which fields are used depends on its type:
+// messages have From, To, Arrow, Activation and a Link, groups a Name ( alt or loop ) and the
+// Elements they contain, refs Participants and Target, spaces a Height. Notes are not supported.
+type DocumentElement struct {
+	Type         string            `json:"type"`
+	From         string            `json:"from,omitempty"`
+	To           string            `json:"to,omitempty"`
+	Arrow        string            `json:"arrow,omitempty"`
+	Activation   string            `json:"activation,omitempty"`
+	Participants []string          `json:"participants,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	Target       string            `json:"target,omitempty"`
+	Link         string            `json:"link,omitempty"`
+	Height       int               `json:"height,omitempty"`
+	Elements     []DocumentElement `json:"elements,omitempty"`
+}
+
+// arrow and activation of each message type.
+var messageKinds = map[int][2]string{
+	ST_SOLID:                {ARROW_SOLID, ""},
+	ST_DOTTED:               {ARROW_DOTTED, ""},
+	ST_START_PROCESS:        {ARROW_SOLID, ACTIVATION_START},
+	ST_END_PROCESS:          {ARROW_SOLID, ACTIVATION_END},
+	ST_START_DOTTED_PROCESS: {ARROW_DOTTED, ACTIVATION_START},
+	ST_END_DOTTED_PROCESS:   {ARROW_DOTTED, ACTIVATION_END},
+}
+
+// Document exports what Parse found, Layout doesn't have to run. Groups left open in the
+// source are closed at the end.
+func (d *Diagram) Document() Document {
+	doc := Document{Version: DOCUMENT_VERSION, Participants: []DocumentParticipant{}, Elements: []DocumentElement{}}
+	for _, p := range d.participants {
+		doc.Participants = append(doc.Participants, DocumentParticipant{Name: p.name, Link: p.link})
+	}
+	for _, b := range d.boxes {
+		box := DocumentBox{Name: b.name, Participants: []string{}}
+		if b.fill != nil {
+			c := color.RGBAModel.Convert(b.fill).(color.RGBA)
+			box.Color = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+		}
+		for _, p := range b.participants {
+			box.Participants = append(box.Participants, p.name)
+		}
+		doc.Boxes = append(doc.Boxes, box)
+	}
+
+	// the element lists of the open groups, the innermost last.
+	open := []*[]DocumentElement{&doc.Elements}
+	for _, s := range d.sequences {
+		var el DocumentElement
+		if kind, ok := messageKinds[s.Type()]; ok {
+			el = DocumentElement{Type: ELEMENT_MESSAGE, From: s.PrimaryParticipant().name, To: s.SecondaryParticipant().name,
+				Arrow: kind[0], Activation: kind[1], Text: s.Text(), Link: sequenceLink(s)}
+		}
+		switch seq := s.(type) {
+		case *StartGroupMessage:
+			el = DocumentElement{Type: ELEMENT_GROUP, Name: seq.name, Text: seq.message, Elements: []DocumentElement{}}
+		case *EndGroupMessage:
+			if len(open) > 1 {
+				open = open[:len(open)-1]
+			}
+			continue
+		case *Ref:
+			el = DocumentElement{Type: ELEMENT_REF, Text: seq.message, Target: seq.target}
+			for _, p := range seq.participants {
+				el.Participants = append(el.Participants, p.name)
+			}
+		case *Delay:
+			el = DocumentElement{Type: ELEMENT_DELAY, Text: seq.message}
+		case *Divider:
+			el = DocumentElement{Type: ELEMENT_DIVIDER, Text: seq.message}
+		case *Space:
+			el = DocumentElement{Type: ELEMENT_SPACE, Height: seq.height}
+		}
+		if len(el.Type) == 0 {
+			continue
+		}
+
+		elements := open[len(open)-1]
+		*elements = append(*elements, el)
+		if el.Type == ELEMENT_GROUP {
+			open = append(open, &(*elements)[len(*elements)-1].Elements)
+		}
+	}
+	return doc
+}
+
+// MarshalJSON writes the diagram as a Document.
+func (d *Diagram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Document())
+}
+
+// MarshalDiagram is json.Marshal of the Document of d.
+func MarshalDiagram(d *Diagram) ([]byte, error) {
+	return d.MarshalJSON()
+}
+
+// ParseDocument reads a json Document and checks its version.
+func ParseDocument(data []byte) (Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, fmt.Errorf("Invalid document: %s", err.Error())
+	}
+	if doc.Version != DOCUMENT_VERSION {
+		return doc, fmt.Errorf("Unsupported document version %d, expected %d", doc.Version, DOCUMENT_VERSION)
+	}
+	return doc, nil
+}
+
+// UnmarshalDiagram builds a diagram from a json Document, it can be laid out and encoded like
+// a parsed one. The statements go through the same steps as those of a Builder, diagnostics have
+// the json Path of the element they are about instead of a line.
+func UnmarshalDiagram(data []byte, cfg Config) (*Diagram, error) {
+	d, err := NewDiagramWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.unmarshal(data); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateDiagramFromJSON is CreateDiagramWithConfig for a json Document.
+func CreateDiagramFromJSON(data []byte, cfg Config) ([]byte, []Diagnostic, error) {
+	r, err := NewRenderer(WithConfig(cfg))
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return r.RenderDocument(data)
+}
+
+// unmarshal adds the statements of a json Document to the empty diagram d, within its limits
+// like Parse.
+func (d *Diagram) unmarshal(data []byte) error {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return err
+	}
+	statements, err := doc.statements()
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("Empty sequence")
+	}
+	if err := d.limits.checkSource(string(data), len(statements)); err != nil {
+		return err
+	}
+	// statements are numbered like lines while they are added.
+	pathOf := func(dg Diagnostic) Diagnostic {
+		if dg.Line >= 1 && dg.Line <= len(statements) {
+			dg.Path = statements[dg.Line-1].path
+		}
+		dg.Line = 0
+		return dg
+	}
+	st := &parseState{}
+	for i, s := range statements {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		if err := checkStatement(s.typ, s.data); err != nil {
+			return pathOf(d.errorAt(i+1, err))
+		}
+		if err := d.addStatement(st, s.data, s.typ, i+1); err != nil {
+			if dg, ok := err.(Diagnostic); ok {
+				return pathOf(dg)
+			}
+			return err
+		}
+		if err := d.limits.checkStatement(d, s.data, i+1); err != nil {
+			// the statement numbers are no lines of the document.
+			if le, ok := err.(LimitError); ok {
+				le.Line = 0
+				return le
+			}
+			return err
+		}
+	}
+	if err := d.endStatements(st); err != nil {
+		if dg, ok := err.(Diagnostic); ok {
+			return pathOf(dg)
+		}
+		return err
+	}
+	for i := range d.warnings {
+		d.warnings[i] = pathOf(d.warnings[i])
+	}
+	return nil
+}
+
+// documentStatement is a statement of a Document, path is the element it comes from.
+type documentStatement struct {
+	path string
+	typ  int
+	data map[string]interface{}
+}
+
+// statements turns the document into the statements Parse would add for its Source, in the
+// same order.
+func (doc Document) statements() ([]documentStatement, error) {
+	var statements []documentStatement
+	add := func(path string, typ int, data map[string]interface{}) {
+		statements = append(statements, documentStatement{path: path, typ: typ, data: data})
+	}
+	participant := func(path string, name string, link string) {
+		data := map[string]interface{}{"name": name}
+		if len(link) > 0 {
+			data["link"] = link
+		}
+		add(path, ST_PARTICIPANT, data)
+	}
+	doc.walkParticipants(func(i int, p DocumentParticipant) {
+		participant(fmt.Sprintf("participants[%d]", i), p.Name, p.Link)
+	}, func(i int, b DocumentBox, links map[string]string) {
+		path := fmt.Sprintf("boxes[%d]", i)
+		add(path, ST_BOX_START, map[string]interface{}{"text": b.Name, "color": b.Color})
+		for j, name := range b.Participants {
+			participant(fmt.Sprintf("%s.participants[%d]", path, j), name, links[name])
+		}
+		add(path, ST_BOX_END, map[string]interface{}{})
+	})
+
+	var walk func(path string, elements []DocumentElement) error
+	walk = func(path string, elements []DocumentElement) error {
+		for i, el := range elements {
+			path := fmt.Sprintf("%s[%d]", path, i)
+			typ, err := elementType(path, el)
+			if err != nil {
+				return err
+			}
+			switch typ {
+			case ST_GROUP_MESSAGE:
+				add(path, typ, map[string]interface{}{"name": el.Name, "text": el.Text})
+				if err := walk(path+".elements", el.Elements); err != nil {
+					return err
+				}
+				add(path, ST_END_GROUP, map[string]interface{}{})
+			case ST_REF:
+				src := make([]interface{}, 0, len(el.Participants))
+				for _, p := range el.Participants {
+					src = append(src, p)
+				}
+				add(path, typ, map[string]interface{}{"src": src, "text": el.Text, "target": el.Target})
+			case ST_DELAY, ST_DIVIDER:
+				add(path, typ, map[string]interface{}{"text": el.Text})
+			case ST_SPACE:
+				height := el.Height
+				if height == 0 {
+					height = CONFIG_SPACE_HEIGHT
+				}
+				add(path, typ, map[string]interface{}{"text": "", "height": float64(height)})
+			default:
+				data := map[string]interface{}{"src": el.From, "dest": el.To, "text": el.Text}
+				if len(el.Link) > 0 {
+					data["link"] = el.Link
+				}
+				add(path, typ, data)
+			}
+		}
+		return nil
+	}
+	if err := walk("elements", doc.Elements); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// walkParticipants calls participant for the participants outside of boxes and box for each
+// box, in the order of the participants. Boxes without participants come last.
+func (doc Document) walkParticipants(participant func(i int, p DocumentParticipant), box func(i int, b DocumentBox, links map[string]string)) {
+	boxOf := make(map[string]int)
+	for i, b := range doc.Boxes {
+		for _, name := range b.Participants {
+			boxOf[name] = i
+		}
+	}
+	links := make(map[string]string)
+	for _, p := range doc.Participants {
+		links[p.Name] = p.Link
+	}
+	written := make(map[int]bool)
+	for i, p := range doc.Participants {
+		if b, ok := boxOf[p.Name]; ok {
+			if !written[b] {
+				written[b] = true
+				box(b, doc.Boxes[b], links)
+			}
+			continue
+		}
+		participant(i, p)
+	}
+	for i, b := range doc.Boxes {
+		if !written[i] {
+			box(i, b, links)
+		}
+	}
+}
+
+// elementType checks an element and returns the type of the statement it becomes, groups are
+// their start.
+func elementType(path string, el DocumentElement) (int, error) {
+	switch el.Type {
+	case ELEMENT_MESSAGE:
+		kind := [2]string{el.Arrow, el.Activation}
+		if len(el.Arrow) == 0 {
+			kind[0] = ARROW_SOLID
+		}
+		if len(el.From) == 0 || len(el.To) == 0 {
+			return 0, fmt.Errorf("Invalid %s: messages need from and to", path)
+		}
+		for typ, k := range messageKinds {
+			if k == kind {
+				return typ, nil
+			}
+		}
+		return 0, fmt.Errorf("Invalid %s: unknown arrow %q or activation %q", path, el.Arrow, el.Activation)
+	case ELEMENT_GROUP:
+		if el.Name != "alt" && el.Name != "loop" {
+			return 0, fmt.Errorf("Invalid %s: unknown group %q", path, el.Name)
+		}
+		return ST_GROUP_MESSAGE, nil
+	case ELEMENT_REF:
+		if len(el.Participants) == 0 {
+			return 0, fmt.Errorf("Invalid %s: refs need participants", path)
+		}
+		return ST_REF, nil
+	case ELEMENT_DELAY:
+		return ST_DELAY, nil
+	case ELEMENT_DIVIDER:
+		return ST_DIVIDER, nil
+	case ELEMENT_SPACE:
+		if el.Height < 0 {
+			return 0, fmt.Errorf("Invalid %s: negative height", path)
+		}
+		return ST_SPACE, nil
+	case "note":
+		return 0, fmt.Errorf("Invalid %s: notes are not supported", path)
+	}
+	return 0, fmt.Errorf("Invalid %s: unknown type %q", path, el.Type)
+}
+
+// SourceFromJSON turns a json Document into diagram source.
+func SourceFromJSON(data []byte) (string, error) {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return "", err
+	}
+	return doc.Source()
+}
+
+// Source writes the document in the source syntax: participant declarations ( inside their
+// boxes ) followed by the elements. It fails for texts the syntax can't hold, every line has to
+// read back as the statement it was written for.
+func (doc Document) Source() (string, error) {
+	statements, err := doc.statements()
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(statements))
+	level := 0
+	for _, s := range statements {
+		if s.typ == ST_END_GROUP || s.typ == ST_BOX_END {
+			level--
+		}
+		line, err := s.source()
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, strings.Repeat(SOURCE_INDENT, level)+line)
+		if s.typ == ST_GROUP_MESSAGE || s.typ == ST_BOX_START {
+			level++
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// source writes the statement as a line of source, it fails when ParseLine reads the line as
+// another statement or with other values.
+func (s documentStatement) source() (string, error) {
+	line, ok := statementSource(s.typ, s.data)
+	if !ok {
+		return "", fmt.Errorf("Invalid %s: no source statement", s.path)
+	}
+	if strings.ContainsAny(line, "\r\n") {
+		return "", fmt.Errorf("Invalid %s: values can't span lines", s.path)
+	}
+	var parsed map[string]interface{}
+	jsonstr, typ, err := ParseLine(line)
+	if err == nil {
+		err = json.Unmarshal([]byte(jsonstr), &parsed)
+	}
+	if err != nil || typ != s.typ || !sameStatement(s.data, parsed) {
+		return "", fmt.Errorf("Invalid %s: %q doesn't fit the source syntax", s.path, line)
+	}
+	return line, nil
+}
+
+// sameStatement compares the values of two statements, the type ParseLine adds is left out.
+func sameStatement(a map[string]interface{}, b map[string]interface{}) bool {
+	for _, m := range []map[string]interface{}{a, b} {
+		for k := range m {
+			if k != "type" && !reflect.DeepEqual(a[k], b[k]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// linkSuffix is the [[url]] written after a linked statement.
+func linkSuffix(link string) string {
+	if len(link) == 0 {
+		return ""
+	}
+	return " [[" + link + "]]"
+}
@@ -0,0 +1,115 @@
+package sequence
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const documentSource = `participant C
+box "Backend" #ff0000
+  participant B
+end box
+A ->+ B: login
+alt ok
+  B -->- A: token
+  loop retry
+    ref over A, B: Refresh [[refresh]]
+  end
+end
+... later ...
+== done ==
+||40||
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	d, err := NewDiagram()
+	assert.NoError(t, err)
+	assert.NoError(t, d.Parse(documentSource))
+
+	data, err := json.Marshal(d)
+	assert.NoError(t, err)
+	doc, err := ParseDocument(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []DocumentParticipant{{Name: "C"}, {Name: "B"}, {Name: "A"}}, doc.Participants)
+	assert.Equal(t, []DocumentBox{{Name: "Backend", Color: "#ff0000", Participants: []string{"B"}}}, doc.Boxes)
+	if assert.Len(t, doc.Elements, 5) {
+		assert.Equal(t, DocumentElement{Type: ELEMENT_MESSAGE, From: "A", To: "B", Arrow: ARROW_SOLID, Activation: ACTIVATION_START, Text: "login"}, doc.Elements[0])
+		group := doc.Elements[1]
+		assert.Equal(t, "alt", group.Name)
+		if assert.Len(t, group.Elements, 2) {
+			assert.Equal(t, DocumentElement{Type: ELEMENT_MESSAGE, From: "B", To: "A", Arrow: ARROW_DOTTED, Activation: ACTIVATION_END, Text: "token"}, group.Elements[0])
+			assert.Equal(t, []DocumentElement{{Type: ELEMENT_REF, Participants: []string{"A", "B"}, Text: "Refresh", Target: "refresh"}}, group.Elements[1].Elements)
+		}
+		assert.Equal(t, DocumentElement{Type: ELEMENT_SPACE, Height: 40}, doc.Elements[4])
+	}
+
+	// json -> diagram -> json gives the same document.
+	d2, err := UnmarshalDiagram(data, DefaultConfig())
+	assert.NoError(t, err)
+	again, err := MarshalDiagram(d2)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(data), string(again))
+	assert.NoError(t, d2.Layout())
+	_, err = d2.Encode(FORMAT_SVG)
+	assert.NoError(t, err)
+
+	source, err := doc.Source()
+	assert.NoError(t, err)
+	assert.Equal(t, FormatSource(source), source)
+}
+
+func TestDocumentErrors(t *testing.T) {
+	_, err := UnmarshalDiagram([]byte(`{"version": 2, "elements": []}`), DefaultConfig())
+	assert.EqualError(t, err, "Unsupported document version 2, expected 1")
+
+	_, err = UnmarshalDiagram([]byte(`{"version": 1`), DefaultConfig())
+	assert.Error(t, err)
+
+	for doc, expected := range map[string]string{
+		`{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "arrow": "wavy"}]}`:                `Invalid elements[0]: unknown arrow "wavy" or activation ""`,
+		`{"version": 1, "elements": [{"type": "group", "name": "alt", "elements": [{"type": "message"}]}]}`:         "Invalid elements[0].elements[0]: messages need from and to",
+		`{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "text": "hi\nA -> C: injected"}]}`: "Invalid elements[0]: values can't span lines",
+		`{"version": 1, "elements": [{"type": "note", "side": "top", "participants": ["A"]}]}`:                      `Invalid elements[0]: notes are not supported`,
+		`{"version": 1, "elements": [{"type": "arrow"}]}`:                                                           `Invalid elements[0]: unknown type "arrow"`,
+		`{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "text": "GET /x"}]}`:               `Invalid elements[0]: "A -> B: GET /x" doesn't fit the source syntax`,
+		`{"version": 1, "elements": [{"type": "group", "name": "alt", "text": "say \"hi\""}]}`:                      `Invalid elements[0]: "alt say \"hi\"" doesn't fit the source syntax`,
+		`{"version": 1, "participants": [{"name": "A B"}], "elements": []}`:                                         `Invalid participants[0]: "participant A B" doesn't fit the source syntax`,
+	} {
+		_, err := SourceFromJSON([]byte(doc))
+		assert.EqualError(t, err, expected, doc)
+	}
+
+	// diagnostics point at the element instead of a line.
+	_, err = UnmarshalDiagram([]byte(`{"version": 1, "participants": [{"name": "A"}, {"name": " "}], "elements": []}`), DefaultConfig())
+	if assert.IsType(t, Diagnostic{}, err) {
+		assert.Equal(t, "participants[1]", err.(Diagnostic).Path)
+		assert.EqualError(t, err, "participants[1]: Empty participant name")
+	}
+	_, err = UnmarshalDiagram([]byte(`{"version": 1, "elements": [{"type": "note", "participants": ["A"]}]}`), DefaultConfig())
+	assert.EqualError(t, err, "Invalid elements[0]: notes are not supported")
+}
+
+func TestUnmarshalDiagramTexts(t *testing.T) {
+	// texts don't have to fit the source syntax, like with a Builder.
+	d, err := UnmarshalDiagram([]byte(`{"version": 1, "elements": [
+		{"type": "message", "from": "Client", "to": "API", "text": "GET /x?y=1", "activation": "activate"},
+		{"type": "group", "name": "alt", "text": "200 & cached", "elements": [
+			{"type": "message", "from": "API", "to": "Client", "arrow": "dotted", "activation": "deactivate", "text": "{\"ok\": true}"}
+		]},
+		{"type": "message", "from": "API", "to": "Client", "activation": "deactivate", "text": "again"}
+	]}`), DefaultConfig())
+	assert.NoError(t, err)
+	doc := d.Document()
+	if assert.Len(t, doc.Elements, 3) {
+		assert.Equal(t, "GET /x?y=1", doc.Elements[0].Text)
+		assert.Equal(t, "200 & cached", doc.Elements[1].Text)
+		assert.Equal(t, `{"ok": true}`, doc.Elements[1].Elements[0].Text)
+	}
+	if assert.Len(t, d.Warnings(), 1) {
+		assert.Equal(t, Diagnostic{Severity: SEVERITY_WARNING, Path: "elements[2]", Message: "API is deactivated without a matching activation"}, d.Warnings()[0])
+	}
+	assert.NoError(t, d.Layout())
+	_, err = d.Encode(FORMAT_SVG)
+	assert.NoError(t, err)
+}
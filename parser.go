@@ -1,58 +1,77 @@
 package sequence
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
 )
 
+// LINK_PATTERN is the optional [[url]] at the end of participants and messages, quotes and
+// backslashes can't be in a link as the parsed line is json.
+const LINK_PATTERN = `(?:\s*\[\[([^\]\s"\\]+)\]\])?`
+
+// withLink adds the link of a statement to its json, when it has one.
+func withLink(jsonstr string, link string) string {
+	if len(link) == 0 {
+		return jsonstr
+	}
+	return strings.TrimSuffix(jsonstr, "}") + fmt.Sprintf(`, "link": "%s"}`, link)
+}
+
+// jsonText escapes free text for the json of a parsed line.
+func jsonText(text string) string {
+	quoted, _ := json.Marshal(text)
+	return string(quoted[1 : len(quoted)-1])
+}
+
 // ParseLine validated at
 // https://regex-golang.appspot.com/assets/html/index.html
 func ParseLine(str string) (string, int, error) {
 
 	// A -> B: Message
-	solid := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	solid := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 
 	match := solid.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"solid", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_SOLID, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"solid", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_SOLID, nil
 
 	}
 
 	// A --> B : Message
-	dotted := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	dotted := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 	match = dotted.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"dotted", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_DOTTED, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"dotted", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_DOTTED, nil
 	}
 
 	//A ->+ B: Message
-	startProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\+\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	startProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\+\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 	match = startProcess.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"start_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_START_PROCESS, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"start_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_START_PROCESS, nil
 	}
 
 	// A ->- B: Message
-	endProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\-\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	endProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*->\-\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 
 	match = endProcess.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"end_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_END_PROCESS, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"end_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_END_PROCESS, nil
 	}
 
 	// A -->+ B: Message
-	startDottedProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\+\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	startDottedProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\+\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 	match = startDottedProcess.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"start_dotted_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_START_DOTTED_PROCESS, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"start_dotted_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_START_DOTTED_PROCESS, nil
 	}
 
 	// A -->- B: Message
-	endDottedProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\-\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)\s*$`)
+	endDottedProcess := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\s*-->\-\s*([a-zA-Z0-9]+)\s*:\s*([a-zA-Z0-9\s]+)` + LINK_PATTERN + `\s*$`)
 	match = endDottedProcess.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
-		return fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"end_dotted_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), ST_END_DOTTED_PROCESS, nil
+		return withLink(fmt.Sprintf(`{"src": "%s","dest":"%s", "type":"end_dotted_process", "text": "%s"}`, match[0][1], match[0][2], match[0][3]), match[0][4]), ST_END_DOTTED_PROCESS, nil
 	}
 
 	// note over A, B: Message
@@ -85,6 +104,71 @@ func ParseLine(str string) (string, int, error) {
 		return fmt.Sprintf(`{"src": ["%s"],"type":"notes", "side": "left", "text": "%s"}`, match[0][1], match[0][2]), ST_NOTE_LEFT, nil
 	}
 
+	// participant A
+	participant := regexp.MustCompile(`^\s*participant\s+([a-zA-Z0-9]+)` + LINK_PATTERN + `\s*$`)
+	match = participant.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return withLink(fmt.Sprintf(`{"type":"participant", "name": "%s"}`, match[0][1]), match[0][2]), ST_PARTICIPANT, nil
+	}
+
+	// box "Backend" #lightblue
+	box := regexp.MustCompile(`^\s*box(?:\s+"([^"]*)")?\s*(#\w+)?\s*$`)
+	match = box.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return fmt.Sprintf(`{"type":"box", "text": "%s", "color": "%s"}`, jsonText(match[0][1]), match[0][2]), ST_BOX_START, nil
+	}
+
+	endBox := regexp.MustCompile(`^\s*end\s+box\s*$`)
+	match = endBox.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return `{"type":"end_box"}`, ST_BOX_END, nil
+	}
+
+	// ref over A, B : Login flow [[login]]
+	ref := regexp.MustCompile(`^\s*ref over\s*([,\w\s]+?)\s*:\s*(.+?)` + LINK_PATTERN + `\s*$`)
+	match = ref.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		csvKeys := strings.Split(match[0][1], ",")
+		var keys []string
+		for _, n := range csvKeys {
+			keys = append(keys, fmt.Sprintf(`"%s"`, strings.Trim(n, " ")))
+		}
+		allKeys := strings.Join(keys, ",")
+		return fmt.Sprintf(`{"src": [%s],"type":"ref", "text": "%s", "target": "%s"}`, allKeys, jsonText(match[0][2]), match[0][3]), ST_REF, nil
+	}
+
+	// ...
+	delay := regexp.MustCompile(`^\s*\.\.\.\s*$`)
+	match = delay.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return `{"type":"delay", "text": ""}`, ST_DELAY, nil
+	}
+
+	// ...5 minutes later...
+	delayText := regexp.MustCompile(`^\s*\.\.\.\s*(.+?)\s*\.\.\.\s*$`)
+	match = delayText.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return fmt.Sprintf(`{"type":"delay", "text": "%s"}`, jsonText(match[0][1])), ST_DELAY, nil
+	}
+
+	// == Phase 2 ==
+	divider := regexp.MustCompile(`^\s*==\s*(.*?)\s*==\s*$`)
+	match = divider.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		return fmt.Sprintf(`{"type":"divider", "text": "%s"}`, jsonText(match[0][1])), ST_DIVIDER, nil
+	}
+
+	// ||| or ||45||
+	space := regexp.MustCompile(`^\s*(?:\|\|\||\|\|(\d+)\|\|)\s*$`)
+	match = space.FindAllStringSubmatch(str, -1)
+	if len(match) > 0 {
+		height := match[0][1]
+		if len(height) == 0 {
+			height = fmt.Sprintf("%d", CONFIG_SPACE_HEIGHT)
+		}
+		return fmt.Sprintf(`{"type":"space", "text": "", "height": %s}`, height), ST_SPACE, nil
+	}
+
 	alt := regexp.MustCompile(`^\s*alt \s*(.*)$`)
 	match = alt.FindAllStringSubmatch(str, -1)
 	if len(match) > 0 {
@@ -284,3 +284,149 @@ func TestNotesOverMultipleMultiLine(t *testing.T) {
 //
 //	return true, nil
 //}
+
+func TestReadDelay(t *testing.T) {
+	actualOutput := make(map[string]interface{})
+	outputJsonObj := make(map[string]interface{})
+	outputJson := `{"type":"delay", "text": ""}`
+	err := json.Unmarshal([]byte(outputJson), &outputJsonObj)
+	assert.NoError(t, err)
+
+	output, typ, err := ParseLine(" ... ")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_DELAY, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, outputJsonObj, actualOutput)
+
+	outputJsonObj = make(map[string]interface{})
+	outputJson = `{"type":"delay", "text": "5 minutes later"}`
+	err = json.Unmarshal([]byte(outputJson), &outputJsonObj)
+	assert.NoError(t, err)
+
+	output, typ, err = ParseLine("...5 minutes later...")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_DELAY, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, outputJsonObj, actualOutput)
+
+	output, typ, err = ParseLine(`... 5 min. "später" ...`)
+	assert.NoError(t, err)
+	assert.Equal(t, ST_DELAY, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, `5 min. "später"`, actualOutput["text"])
+}
+
+func TestReadDivider(t *testing.T) {
+	actualOutput := make(map[string]interface{})
+	outputJsonObj := make(map[string]interface{})
+	outputJson := `{"type":"divider", "text": "Phase 2"}`
+	err := json.Unmarshal([]byte(outputJson), &outputJsonObj)
+	assert.NoError(t, err)
+
+	output, typ, err := ParseLine("== Phase 2 ==")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_DIVIDER, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, outputJsonObj, actualOutput)
+
+	output, typ, err = ParseLine("== Phase 2: rollout ==")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_DIVIDER, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "Phase 2: rollout", actualOutput["text"])
+}
+
+func TestReadSpace(t *testing.T) {
+	output, typ, err := ParseLine("|||")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_SPACE, typ)
+	actualOutput := make(map[string]interface{})
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, CONFIG_SPACE_HEIGHT, actualOutput["height"])
+
+	output, typ, err = ParseLine("||45||")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_SPACE, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 45, actualOutput["height"])
+
+	_, _, err = ParseLine("||45|")
+	assert.Error(t, err)
+}
+
+func TestReadRef(t *testing.T) {
+	actualOutput := make(map[string]interface{})
+	outputJsonObj := make(map[string]interface{})
+	outputJson := `{"src": ["A", "B"], "type":"ref", "text": "Login flow", "target": ""}`
+	err := json.Unmarshal([]byte(outputJson), &outputJsonObj)
+	assert.NoError(t, err)
+
+	output, typ, err := ParseLine("ref over A, B : Login flow")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_REF, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, outputJsonObj, actualOutput)
+
+	outputJsonObj = make(map[string]interface{})
+	outputJson = `{"src": ["A"], "type":"ref", "text": "Login flow", "target": "login-v2"}`
+	err = json.Unmarshal([]byte(outputJson), &outputJsonObj)
+	assert.NoError(t, err)
+
+	output, typ, err = ParseLine("ref over A: Login flow [[login-v2]]")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_REF, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.EqualValues(t, outputJsonObj, actualOutput)
+
+	output, typ, err = ParseLine(`ref over A, B: Login (v2), step 1/2 "sso" [[https://example.com/login?v=2]]`)
+	assert.NoError(t, err)
+	assert.Equal(t, ST_REF, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, `Login (v2), step 1/2 "sso"`, actualOutput["text"])
+	assert.Equal(t, "https://example.com/login?v=2", actualOutput["target"])
+}
+
+func TestReadParticipantAndBox(t *testing.T) {
+	actualOutput := make(map[string]interface{})
+	output, typ, err := ParseLine("participant Auth")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_PARTICIPANT, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "Auth", actualOutput["name"])
+
+	actualOutput = make(map[string]interface{})
+	output, typ, err = ParseLine(`box "Backend" #lightblue`)
+	assert.NoError(t, err)
+	assert.Equal(t, ST_BOX_START, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "Backend", actualOutput["text"])
+	assert.Equal(t, "#lightblue", actualOutput["color"])
+
+	actualOutput = make(map[string]interface{})
+	output, typ, err = ParseLine(`box "Back-end (EU), v2\\" #red`)
+	assert.NoError(t, err)
+	assert.Equal(t, ST_BOX_START, typ)
+	err = json.Unmarshal([]byte(output), &actualOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, `Back-end (EU), v2\\`, actualOutput["text"])
+
+	_, typ, err = ParseLine("end box")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_BOX_END, typ)
+
+	_, typ, err = ParseLine("end")
+	assert.NoError(t, err)
+	assert.Equal(t, ST_END_GROUP, typ)
+}
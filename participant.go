@@ -9,4 +9,40 @@ type Participant struct {
 	delta        int
 	processStack utils.Stack
 	processes    []*Process
+	box          *Box
+	// source line the participant first appeared on and of its participant declaration ( 0 when
+	// it is never declared ).
+	line        int
+	declaration int
+	// url the participant links to, empty without one.
+	link string
+}
+
+// ParticipantInfo describes where a participant is declared and how much it is used, for
+// editor tooling.
+type ParticipantInfo struct {
+	Name string `json:"name"`
+	// the declaration, or the first use when the participant is never declared.
+	Line     int  `json:"line"`
+	Declared bool `json:"declared"`
+	Messages int  `json:"messages"`
+}
+
+// ParticipantInfo lists the participants found by Parse in order of appearance.
+func (d *Diagram) ParticipantInfo() []ParticipantInfo {
+	infos := make([]ParticipantInfo, 0, len(d.participants))
+	for _, p := range d.participants {
+		info := ParticipantInfo{Name: p.name, Line: p.line}
+		if p.declaration > 0 {
+			info.Line = p.declaration
+			info.Declared = true
+		}
+		for _, s := range d.sequences {
+			if IsMessage(s) && (s.PrimaryParticipant() == p || s.SecondaryParticipant() == p) {
+				info.Messages++
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
 }
@@ -0,0 +1,59 @@
+package sequence
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+)
+
+// encodePDF puts the image on a single page of width x height points, the pixels of a scaled
+// image are kept so it prints sharper. The page has no transparency, like jpeg it is white
+// behind the diagram.
+func encodePDF(i image.Image, width int, height int) ([]byte, error) {
+	b := i.Bounds()
+	pixels := new(bytes.Buffer)
+	zw := zlib.NewWriter(pixels)
+	row := make([]byte, 0, b.Dx()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := i.At(x, y).RGBA()
+			row = append(row, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return []byte{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return []byte{}, err
+	}
+	content := fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q\n", width, height)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.4\n")
+	var offsets []int
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>", nil)
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", width, height), nil)
+	object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>", b.Dx(), b.Dy(), pixels.Len()), pixels.Bytes())
+	object(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes(), nil
+}
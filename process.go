@@ -7,4 +7,6 @@ type Process struct {
 	end      Sequence
 	parent   *Process
 	position utils.Rectangle
+	// line in the source that started the process.
+	line int
 }
@@ -0,0 +1,174 @@
+package sequence
+
+import (
+	"fmt"
+	"github.com/fogleman/gg"
+	"go-sequencediagrams/utils"
+	"golang.org/x/image/font"
+	"strings"
+)
+
+// Ref is an interaction use ( ref over A, B : Login flow ). It is drawn as a single box over
+// the lifelines of its participants and can link to another diagram, by the name it is
+// stored under ( a relative url ) or a url.
+type Ref struct {
+	participants []*Participant
+	message      string
+	target       string
+	position     utils.Rectangle
+	index        int
+	seqType      int
+	// left most and right most participants, only known once all participants are placed.
+	primary   *Participant
+	secondary *Participant
+}
+
+func (r *Ref) Type() int {
+	return r.seqType
+}
+
+func (r *Ref) PrimaryParticipant() *Participant {
+	return r.primary
+}
+
+func (r *Ref) SecondaryParticipant() *Participant {
+	return r.secondary
+}
+
+func (r *Ref) Text() string {
+	return r.message
+}
+
+// Target is the name of the diagram this ref points at, empty when it doesn't link anywhere.
+func (r *Ref) Target() string {
+	return r.target
+}
+
+// Link is the target, a ref links to the diagram it points at.
+func (r *Ref) Link() string {
+	return r.target
+}
+
+func (r *Ref) SetPosition(rectangle utils.Rectangle) {
+	r.position = rectangle
+}
+
+func (r *Ref) Position() utils.Rectangle {
+	return r.position
+}
+
+func (r *Ref) IsStartProcess() bool {
+	return false
+}
+
+func (r *Ref) IsEndProcess() bool {
+	return false
+}
+
+func (r *Ref) SetStartProcess(*Process) {
+	return
+}
+
+func (r *Ref) SetEndProcess(*Process) {
+	return
+}
+
+func (r *Ref) Index() int {
+	return r.index
+}
+
+func (r *Ref) Init(data map[string]interface{}, d *Diagram, index int, seqType int) error {
+	r.index = index
+	r.seqType = seqType
+	r.message = data["text"].(string)
+	r.target = data["target"].(string)
+	for _, n := range data["src"].([]interface{}) {
+		name := strings.TrimSpace(n.(string))
+		if len(name) == 0 {
+			continue
+		}
+		r.participants = append(r.participants, d.GetOrCreateParticipant(name))
+	}
+	if len(r.participants) == 0 {
+		return fmt.Errorf("ref without participants")
+	}
+	r.primary = r.participants[0]
+	r.secondary = r.participants[0]
+	return nil
+}
+
+func (r *Ref) MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle {
+	// participants don't move from here on, pick the outer most ones to span.
+	for _, p := range r.participants {
+		if d.participantMap[p.name] < d.participantMap[r.primary.name] {
+			r.primary = p
+		}
+		if d.participantMap[p.name] > d.participantMap[r.secondary.name] {
+			r.secondary = p
+		}
+	}
+
+	dc := d.dc
+	dc.Push()
+	defer dc.Pop()
+	dc.SetFontFace(sequenceFont)
+
+	textWidth, textHeight := dc.MeasureString(r.message)
+	if textWidth > CONFIG_GROUP_MAX_WIDTH {
+		lines := dc.WordWrap(r.message, CONFIG_GROUP_MAX_WIDTH)
+		textHeight = float64(len(lines)) * float64(textHeight+CONFIG_MESSAGE_LINE_SPACING)
+		textWidth = CONFIG_GROUP_MAX_WIDTH
+	}
+	w := int(textWidth) + CONFIG_TEXT_PADDING_X*2
+	h := int(textHeight) + CONFIG_TEXT_PADDING_Y*2 + CONFIG_MIN_PADDING_Y
+	return utils.Rect(0, 0, w, h)
+}
+
+// frameX is the left edge and width of the ref box, over its participants.
+func (r *Ref) frameX() (float64, float64) {
+	x1 := float64(r.primary.position.Min.X)
+	w := float64(r.secondary.position.Max.X) - x1
+	if w < float64(r.position.Dx()) {
+		// the text is wider than the participants, grow around the center.
+		x1 -= (float64(r.position.Dx()) - w) / 2
+		w = float64(r.position.Dx())
+	}
+	return x1, w
+}
+
+// DrawnPosition is the box of the ref once the participants are placed.
+func (r *Ref) DrawnPosition(d *Diagram) utils.Rectangle {
+	x1, w := r.frameX()
+	return utils.Rect(int(x1), r.position.Min.Y, int(x1+w), r.position.Max.Y)
+}
+
+func (r *Ref) Render(d *Diagram, dc Canvas) {
+	dc.Push()
+	defer dc.Pop()
+
+	x1, w := r.frameX()
+	y := float64(r.position.Min.Y)
+	h := float64(r.position.Dy())
+
+	// the box hides the lifelines it covers.
+	dc.DrawRectangle(x1, y, w, h)
+	dc.SetColor(d.theme.RefFill)
+	dc.FillPreserve()
+	dc.SetColor(d.theme.RefLine)
+	dc.Stroke()
+
+	// ref tab on the top left.
+	dc.SetFontFace(d.SequenceFont)
+	tabWidth, _ := dc.MeasureString("ref")
+	tabWidth += CONFIG_TEXT_PADDING_X * 2
+	dc.MoveTo(x1, y+CONFIG_MIN_PADDING_Y)
+	dc.LineTo(x1+tabWidth-CONFIG_TEXT_PADDING_Y, y+CONFIG_MIN_PADDING_Y)
+	dc.LineTo(x1+tabWidth, y+CONFIG_MIN_PADDING_Y-CONFIG_TEXT_PADDING_Y)
+	dc.LineTo(x1+tabWidth, y)
+	dc.Stroke()
+
+	dc.SetColor(d.theme.RefText)
+	dc.DrawStringAnchored("ref", x1+CONFIG_TEXT_PADDING_X, y+CONFIG_MIN_PADDING_Y/2, 0, 0.5)
+	dc.DrawStringWrapped(r.message, x1+w/2, y+CONFIG_MIN_PADDING_Y+(h-CONFIG_MIN_PADDING_Y)/2, 0.5, 0.5,
+		CONFIG_GROUP_MAX_WIDTH, CONFIG_MESSAGE_LINE_SPACING, gg.AlignCenter)
+}
@@ -0,0 +1,147 @@
+package sequence
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CachedRender is a rendered diagram kept by the RenderCache.
+type CachedRender struct {
+	Key      string
+	Data     []byte
+	Warnings []Diagnostic
+	Created  time.Time
+}
+
+// RenderCache keeps recently rendered diagrams keyed by Renderer.Key, the least recently used
+// ones are dropped once the images take more than maxBytes. Entries older than ttl are
+// rendered again, a ttl of 0 keeps them until they are evicted.
+type RenderCache struct {
+	mutex    sync.Mutex
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	now      func() time.Time
+}
+
+func NewRenderCache(maxBytes int64, ttl time.Duration) *RenderCache {
+	return &RenderCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+// RenderKey is the Key of source for a renderer with cfg and the default theme, scale and font.
+func RenderKey(source string, cfg Config) string {
+	r := Renderer{config: cfg, theme: DefaultTheme(), scale: 1, fontID: DEFAULT_FONT_ID}
+	return r.Key(source)
+}
+
+// DocumentKey is RenderKey for a json Document, it never equals the key of a source.
+func DocumentKey(data []byte, cfg Config) string {
+	r := Renderer{config: cfg, theme: DefaultTheme(), scale: 1, fontID: DEFAULT_FONT_ID}
+	return r.DocumentKey(data)
+}
+
+func (rc *RenderCache) Get(key string) (*CachedRender, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	e, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	r := e.Value.(*CachedRender)
+	if rc.ttl > 0 && rc.now().Sub(r.Created) > rc.ttl {
+		rc.remove(e)
+		return nil, false
+	}
+	rc.lru.MoveToFront(e)
+	return r, true
+}
+
+// Put keeps r, images larger than the whole cache are not kept.
+func (rc *RenderCache) Put(r *CachedRender) {
+	size := int64(len(r.Data))
+	if size > rc.maxBytes {
+		return
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if e, ok := rc.entries[r.Key]; ok {
+		rc.remove(e)
+	}
+	rc.entries[r.Key] = rc.lru.PushFront(r)
+	rc.size += size
+	for rc.size > rc.maxBytes {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+// remove drops an entry, callers hold the mutex.
+func (rc *RenderCache) remove(e *list.Element) {
+	r := rc.lru.Remove(e).(*CachedRender)
+	delete(rc.entries, r.Key)
+	rc.size -= int64(len(r.Data))
+}
+
+// Len is the number of cached images.
+func (rc *RenderCache) Len() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.lru.Len()
+}
+
+// Render returns the cached image of source or renders and keeps it, sources that fail to
+// parse are not cached.
+func (rc *RenderCache) Render(source string, cfg Config) (*CachedRender, error) {
+	r, err := NewRenderer(WithConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return rc.RenderContext(context.Background(), r, source)
+}
+
+// RenderDocument is Render for a json Document.
+func (rc *RenderCache) RenderDocument(data []byte, cfg Config) (*CachedRender, error) {
+	r, err := NewRenderer(WithConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return rc.RenderDocumentContext(context.Background(), r, data)
+}
+
+// RenderContext is Render with the renderer and context to use on a miss, renderers with
+// different options share the cache under different keys.
+func (rc *RenderCache) RenderContext(ctx context.Context, renderer *Renderer, source string) (*CachedRender, error) {
+	return rc.render(renderer.Key(source), func() ([]byte, []Diagnostic, error) {
+		return renderer.RenderContext(ctx, source)
+	})
+}
+
+// RenderDocumentContext is RenderContext for a json Document.
+func (rc *RenderCache) RenderDocumentContext(ctx context.Context, renderer *Renderer, data []byte) (*CachedRender, error) {
+	return rc.render(renderer.DocumentKey(data), func() ([]byte, []Diagnostic, error) {
+		return renderer.RenderDocumentContext(ctx, data)
+	})
+}
+
+// render returns the entry of key or keeps what render returns under it.
+func (rc *RenderCache) render(key string, render func() ([]byte, []Diagnostic, error)) (*CachedRender, error) {
+	if r, ok := rc.Get(key); ok {
+		return r, nil
+	}
+	data, warnings, err := render()
+	if err != nil {
+		return nil, err
+	}
+	r := &CachedRender{Key: key, Data: data, Warnings: warnings, Created: rc.now()}
+	rc.Put(r)
+	return r, nil
+}
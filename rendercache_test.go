@@ -0,0 +1,126 @@
+package sequence
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/font/gofont/goregular"
+	"testing"
+	"time"
+)
+
+func TestRenderKey(t *testing.T) {
+	cfg := DefaultConfig()
+	key := RenderKey("A -> B: hello", cfg)
+	assert.Equal(t, key, RenderKey("A -> B: hello", cfg))
+	assert.NotEqual(t, key, RenderKey("A -> B: hello ", cfg))
+
+	cfg.Format = FORMAT_SVG
+	assert.NotEqual(t, key, RenderKey("A -> B: hello", cfg))
+	cfg = DefaultConfig()
+	cfg.SequenceFontSize = 20
+	assert.NotEqual(t, key, RenderKey("A -> B: hello", cfg))
+}
+
+func TestRenderCache(t *testing.T) {
+	now := time.Date(2019, 8, 1, 0, 0, 0, 0, time.UTC)
+	rc := NewRenderCache(10, time.Minute)
+	rc.now = func() time.Time { return now }
+
+	rc.Put(&CachedRender{Key: "a", Data: []byte("aaaa"), Created: now})
+	rc.Put(&CachedRender{Key: "b", Data: []byte("bbbb"), Created: now})
+	_, ok := rc.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used.
+	rc.Put(&CachedRender{Key: "c", Data: []byte("cccc"), Created: now})
+	_, ok = rc.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, rc.Len())
+
+	rc.Put(&CachedRender{Key: "big", Data: []byte("more than ten bytes"), Created: now})
+	_, ok = rc.Get("big")
+	assert.False(t, ok)
+	assert.Equal(t, 2, rc.Len())
+
+	now = now.Add(2 * time.Minute)
+	_, ok = rc.Get("a")
+	assert.False(t, ok, "expired")
+	assert.Equal(t, 1, rc.Len())
+}
+
+func TestRenderCacheRender(t *testing.T) {
+	rc := NewRenderCache(1<<20, 0)
+	r, err := rc.Render("A ->+ B: hello", DefaultConfig())
+	assert.NoError(t, err)
+	assert.Len(t, r.Warnings, 1)
+	again, err := rc.Render("A ->+ B: hello", DefaultConfig())
+	assert.NoError(t, err)
+	assert.True(t, r == again, "second render comes from the cache")
+
+	_, err = rc.Render("not a diagram", DefaultConfig())
+	assert.Error(t, err)
+	assert.Equal(t, 1, rc.Len())
+}
+
+func TestRenderCacheRenderers(t *testing.T) {
+	rc := NewRenderCache(1<<20, 0)
+	light, err := NewRenderer(WithFormat(FORMAT_SVG))
+	assert.NoError(t, err)
+	dark, err := NewRenderer(WithFormat(FORMAT_SVG), WithTheme(DarkTheme()))
+	assert.NoError(t, err)
+	large, err := NewRenderer(WithFormat(FORMAT_SVG), WithScale(2))
+	assert.NoError(t, err)
+
+	// the same source and config drawn differently are cached apart.
+	var data []string
+	for _, r := range []*Renderer{light, dark, large} {
+		cached, err := rc.RenderContext(context.Background(), r, "A -> B: hello")
+		assert.NoError(t, err)
+		expected, _, err := r.Render("A -> B: hello")
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(cached.Data))
+		data = append(data, string(cached.Data))
+	}
+	assert.Equal(t, 3, rc.Len())
+	assert.NotEqual(t, data[0], data[1])
+
+	assert.Equal(t, RenderKey("A -> B: hello", light.Config()), light.Key("A -> B: hello"))
+	assert.NotEqual(t, light.Key("A -> B: hello"), dark.Key("A -> B: hello"))
+	assert.NotEqual(t, light.Key("A -> B: hello"), large.Key("A -> B: hello"))
+	font, err := NewRenderer(WithFormat(FORMAT_SVG), WithFont(goregular.TTF))
+	assert.NoError(t, err)
+	assert.NotEqual(t, light.Key("A -> B: hello"), font.Key("A -> B: hello"), "fonts given to WithFont are keyed by their ttf")
+}
+
+func TestRenderCacheDocuments(t *testing.T) {
+	rc := NewRenderCache(1<<20, 0)
+	r, err := NewRenderer(WithFormat(FORMAT_SVG), WithTheme(DarkTheme()))
+	assert.NoError(t, err)
+	doc := []byte(`{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "text": "hello"}]}`)
+
+	cached, err := rc.RenderDocumentContext(context.Background(), r, doc)
+	assert.NoError(t, err)
+	assert.Equal(t, r.DocumentKey(doc), cached.Key)
+	// the document is drawn with the options of the renderer, like the source it stands for.
+	expected, _, err := r.Render("A -> B: hello")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(cached.Data))
+
+	again, err := rc.RenderDocumentContext(context.Background(), r, doc)
+	assert.NoError(t, err)
+	assert.True(t, cached == again)
+	assert.Equal(t, 1, rc.Len())
+
+	_, err = rc.RenderDocumentContext(context.Background(), r, []byte(`{"version": 1, "elements": []}`))
+	assert.EqualError(t, err, "Empty sequence")
+	assert.Equal(t, 1, rc.Len())
+}
+
+func TestRenderCacheRenderDocument(t *testing.T) {
+	rc := NewRenderCache(1<<20, 0)
+	doc := []byte(`{"version": 1, "elements": [{"type": "message", "from": "A", "to": "B", "text": "hello"}]}`)
+	cached, err := rc.RenderDocument(doc, DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentKey(doc, DefaultConfig()), cached.Key)
+	assert.NotEqual(t, RenderKey("A -> B: hello", DefaultConfig()), cached.Key)
+}
@@ -0,0 +1,211 @@
+package sequence
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/freetype/truetype"
+)
+
+// DEFAULT_FONT_ID names goregular in the keys of renderers, other fonts are named by the hash
+// of their ttf.
+const DEFAULT_FONT_ID = "goregular"
+
+// Renderer renders diagrams with the same options, the font is parsed once when the renderer
+// is created. It is safe for concurrent use, every diagram gets its own font faces.
+type Renderer struct {
+	config Config
+	theme  Theme
+	font   *truetype.Font
+	// tells fonts apart in Key.
+	fontID string
+	scale  float64
+	limits Limits
+}
+
+// RendererOption changes the defaults of NewRenderer.
+type RendererOption func(r *Renderer) error
+
+// WithConfig replaces the format and font sizes.
+func WithConfig(cfg Config) RendererOption {
+	return func(r *Renderer) error {
+		r.config = cfg
+		return nil
+	}
+}
+
+func WithFormat(format string) RendererOption {
+	return func(r *Renderer) error {
+		r.config.Format = format
+		return nil
+	}
+}
+
+func WithTheme(theme Theme) RendererOption {
+	return func(r *Renderer) error {
+		r.theme = theme
+		return nil
+	}
+}
+
+// WithFont draws the text with a truetype font instead of goregular, the svg still names Go as
+// its font family.
+func WithFont(ttf []byte) RendererOption {
+	return func(r *Renderer) error {
+		font, err := truetype.Parse(ttf)
+		if err != nil {
+			return fmt.Errorf("Invalid font: %s", err.Error())
+		}
+		sum := sha256.Sum256(ttf)
+		r.font = font
+		r.fontID = hex.EncodeToString(sum[:])
+		return nil
+	}
+}
+
+func WithFontSizes(sequence float64, participant float64) RendererOption {
+	return func(r *Renderer) error {
+		r.config.SequenceFontSize = sequence
+		r.config.ParticipantFontSize = participant
+		return nil
+	}
+}
+
+// WithScale multiplies the size of the png, jpeg, gif and svg output ( 2 for high dpi
+// screens ), the json layout and the image map are in pixels of the scaled output.
+func WithScale(scale float64) RendererOption {
+	return func(r *Renderer) error {
+		if scale <= 0 {
+			return fmt.Errorf("Invalid scale %v", scale)
+		}
+		r.scale = scale
+		return nil
+	}
+}
+
+// WithLimits makes the renderer fail with a LimitError on diagrams going over limits.
+func WithLimits(limits Limits) RendererOption {
+	return func(r *Renderer) error {
+		r.limits = limits
+		return nil
+	}
+}
+
+// NewRenderer returns a renderer with the default config and theme changed by opts.
+func NewRenderer(opts ...RendererOption) (*Renderer, error) {
+	r := &Renderer{config: DefaultConfig(), theme: DefaultTheme(), scale: 1}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.config.Validate(); err != nil {
+		return nil, err
+	}
+	if r.font == nil {
+		font, err := defaultFont()
+		if err != nil {
+			return nil, err
+		}
+		r.font = font
+		r.fontID = DEFAULT_FONT_ID
+	}
+	return r, nil
+}
+
+// With returns a copy of the renderer changed by opts, the parsed font is shared unless opts
+// replace it. The renderer itself is left as it is.
+func (r *Renderer) With(opts ...RendererOption) (*Renderer, error) {
+	derived := *r
+	for _, opt := range opts {
+		if err := opt(&derived); err != nil {
+			return nil, err
+		}
+	}
+	if err := derived.config.Validate(); err != nil {
+		return nil, err
+	}
+	return &derived, nil
+}
+
+// Key hashes everything the output of source depends on: the config, theme, scale and font of
+// the renderer. Limits only decide whether there is an output, they are left out. The same key
+// always means the same output so it doubles as an ETag.
+func (r *Renderer) Key(source string) string {
+	return r.key('\x00', []byte(source))
+}
+
+// DocumentKey is the Key of a json Document, it never equals the key of a source.
+func (r *Renderer) DocumentKey(data []byte) string {
+	return r.key('\x01', data)
+}
+
+// key hashes the options and input, kind tells sources and documents apart.
+func (r *Renderer) key(kind byte, input []byte) string {
+	h := sha256.New()
+	options, _ := json.Marshal(r.config)
+	h.Write(options)
+	// the type of a color matters, color.Gray{255} is white and color.Gray16{255} is not.
+	fmt.Fprintf(h, "\x00%#v\x00%v\x00%s%c", r.theme, r.scale, r.fontID, kind)
+	h.Write(input)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Config is the config the renderer was created with.
+func (r *Renderer) Config() Config {
+	return r.config
+}
+
+// NewDiagram returns an empty diagram drawn with the options of the renderer, to Parse and
+// Encode by hand.
+func (r *Renderer) NewDiagram() *Diagram {
+	d := newDiagram(r.config, r.font, r.theme, r.scale)
+	d.limits = r.limits
+	return d
+}
+
+// Render parses, lays out and encodes source in the format of the renderer.
+func (r *Renderer) Render(source string) ([]byte, []Diagnostic, error) {
+	return r.RenderContext(context.Background(), source)
+}
+
+// RenderContext renders like Render and gives up with the error of ctx once it is done, it is
+// checked between the lines, the statements laid out and the statements drawn.
+func (r *Renderer) RenderContext(ctx context.Context, source string) ([]byte, []Diagnostic, error) {
+	d := r.NewDiagram()
+	d.ctx = ctx
+	if err := d.Parse(source); err != nil {
+		return []byte{}, nil, err
+	}
+	return r.encode(d)
+}
+
+// RenderDocument renders a json Document like Render renders source, see UnmarshalDiagram.
+func (r *Renderer) RenderDocument(data []byte) ([]byte, []Diagnostic, error) {
+	return r.RenderDocumentContext(context.Background(), data)
+}
+
+// RenderDocumentContext renders a json Document like RenderContext renders source, see
+// UnmarshalDiagram.
+func (r *Renderer) RenderDocumentContext(ctx context.Context, data []byte) ([]byte, []Diagnostic, error) {
+	d := r.NewDiagram()
+	d.ctx = ctx
+	if err := d.unmarshal(data); err != nil {
+		return []byte{}, nil, err
+	}
+	return r.encode(d)
+}
+
+// encode lays out the diagram d and encodes it in the format of the renderer.
+func (r *Renderer) encode(d *Diagram) ([]byte, []Diagnostic, error) {
+	if err := d.Layout(); err != nil {
+		return []byte{}, nil, err
+	}
+	data, err := d.Encode(r.config.Format)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return data, d.Warnings(), nil
+}
@@ -0,0 +1,206 @@
+package sequence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRenderer(t *testing.T) {
+	source := "A ->+ B: hello\nB -->- A: done"
+	expected, err := CreateDiagram(source)
+	assert.NoError(t, err)
+
+	r, err := NewRenderer()
+	assert.NoError(t, err)
+	data, warnings, err := r.Render(source)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, expected, data)
+
+	// one renderer, many goroutines.
+	var wg sync.WaitGroup
+	results := make([][]byte, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = r.Render(source)
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range results {
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestRendererOptions(t *testing.T) {
+	source := "A -> B: hello"
+	r, err := NewRenderer()
+	assert.NoError(t, err)
+	d := r.NewDiagram()
+	assert.NoError(t, d.Parse(source))
+	assert.NoError(t, d.Layout())
+	w, h := d.ComputeImageSize()
+
+	r, err = NewRenderer(WithScale(2), WithTheme(DarkTheme()))
+	assert.NoError(t, err)
+	data, _, err := r.Render(source)
+	assert.NoError(t, err)
+	i, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, w*2, i.Bounds().Dx())
+	assert.Equal(t, h*2, i.Bounds().Dy())
+	assert.Equal(t, color.NRGBAModel.Convert(DarkTheme().Background), color.NRGBAModel.Convert(i.At(0, 0)))
+
+	r, err = NewRenderer(WithFormat(FORMAT_SVG), WithScale(2))
+	assert.NoError(t, err)
+	data, _, err = r.Render(source)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), fmt.Sprintf(`width="%d" height="%d" viewBox="0 0 %d %d"`, w*2, h*2, w, h))
+
+	r, err = NewRenderer(WithFontSizes(20, 24))
+	assert.NoError(t, err)
+	assert.Equal(t, 24.0, r.Config().ParticipantFontSize)
+
+	_, err = NewRenderer(WithFormat("bmp"))
+	assert.EqualError(t, err, "Unsupported format bmp")
+	_, err = NewRenderer(WithScale(0))
+	assert.EqualError(t, err, "Invalid scale 0")
+	_, err = NewRenderer(WithFont([]byte("not a font")))
+	assert.Error(t, err)
+	_, err = NewRenderer(WithFontSizes(0, 14))
+	assert.Error(t, err)
+}
+
+func TestRendererWith(t *testing.T) {
+	r, err := NewRenderer(WithTheme(DarkTheme()), WithScale(2))
+	assert.NoError(t, err)
+	svg, err := r.With(WithFormat(FORMAT_SVG))
+	assert.NoError(t, err)
+	assert.Equal(t, FORMAT_SVG, svg.Config().Format)
+	assert.Equal(t, FORMAT_PNG, r.Config().Format, "the renderer derived from is unchanged")
+	assert.True(t, svg.font == r.font, "the font is not parsed again")
+	assert.Equal(t, r.theme, svg.theme)
+	assert.Equal(t, 2.0, svg.scale)
+
+	_, err = r.With(WithFormat("bmp"))
+	assert.EqualError(t, err, "Unsupported format bmp")
+}
+
+func TestRendererTranslucentTheme(t *testing.T) {
+	theme := DefaultTheme()
+	theme.MessageLine = color.NRGBA{0x80, 0x40, 0x20, 0x80}
+	r, err := NewRenderer(WithFormat(FORMAT_SVG), WithTheme(theme))
+	assert.NoError(t, err)
+	data, _, err := r.Render("A -> B: hello")
+	assert.NoError(t, err)
+	// the color isn't darkened by the alpha, that is left to the opacity.
+	assert.Contains(t, string(data), `stroke="#804020"`)
+}
+
+func TestRendererLimits(t *testing.T) {
+	long := strings.Repeat("x", 11)
+	for _, c := range []struct {
+		limits Limits
+		source string
+		err    LimitError
+	}{
+		{Limits{MaxSourceBytes: 10}, "A -> B: hello", LimitError{Limit: LIMIT_SOURCE_BYTES, Max: 10}},
+		{Limits{MaxLines: 2}, "A -> B: a\nB -> A: b\nA -> B: c", LimitError{Limit: LIMIT_LINES, Max: 2}},
+		{Limits{MaxParticipants: 2}, "A -> B: a\nB -> C: b", LimitError{Limit: LIMIT_PARTICIPANTS, Max: 2, Line: 2}},
+		{Limits{MaxMessageLength: 10}, "A -> B: a\nalt " + long + "\nend", LimitError{Limit: LIMIT_MESSAGE_LENGTH, Max: 10, Line: 2}},
+		{Limits{MaxImagePixels: 100 * 100}, "A -> B: hello", LimitError{Limit: LIMIT_IMAGE_PIXELS, Max: 100 * 100}},
+	} {
+		r, err := NewRenderer(WithLimits(c.limits))
+		assert.NoError(t, err)
+		_, _, err = r.Render(c.source)
+		assert.Equal(t, c.err, err, c.err.Limit)
+	}
+	assert.EqualError(t, LimitError{Limit: LIMIT_PARTICIPANTS, Max: 2, Line: 3}, "line 3: More than 2 participants")
+
+	// limits count the scaled image.
+	r, err := NewRenderer(WithLimits(Limits{MaxImagePixels: 200 * 150}))
+	assert.NoError(t, err)
+	_, _, err = r.Render("A -> B: hello")
+	assert.NoError(t, err)
+	r, err = NewRenderer(WithLimits(Limits{MaxImagePixels: 200 * 150}), WithScale(2))
+	assert.NoError(t, err)
+	_, _, err = r.Render("A -> B: hello")
+	assert.IsType(t, LimitError{}, err)
+
+	_, _, err = CreateDiagramContext(context.Background(), "A -> B: "+long, DefaultConfig(), Limits{MaxMessageLength: 10})
+	assert.IsType(t, LimitError{}, err)
+	result, err := ValidateContext(context.Background(), "A -> B: a\nB -> C: b", DefaultConfig(), Limits{MaxParticipants: 2})
+	assert.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, []Diagnostic{{Severity: SEVERITY_ERROR, Line: 2, Column: 1, Message: "More than 2 participants"}}, result.Diagnostics)
+}
+
+func TestRendererOutputLimits(t *testing.T) {
+	// the outputs that aren't images are refused before they are built too.
+	for _, c := range []struct {
+		format string
+		err    LimitError
+	}{
+		{FORMAT_JSON, LimitError{Limit: LIMIT_IMAGE_PIXELS, Max: 100 * 100}},
+		{FORMAT_MAP, LimitError{Limit: LIMIT_IMAGE_PIXELS, Max: 100 * 100}},
+		{FORMAT_TXT, LimitError{Limit: LIMIT_TEXT_CELLS, Max: 10}},
+	} {
+		r, err := NewRenderer(WithFormat(c.format), WithLimits(Limits{MaxImagePixels: 100 * 100, MaxTextCells: 10}))
+		assert.NoError(t, err)
+		_, _, err = r.Render("A -> B: hello")
+		assert.Equal(t, c.err, err, c.format)
+	}
+}
+
+func TestRendererTextLimit(t *testing.T) {
+	// long texts between many participants, the text output would be over a gigabyte.
+	var source strings.Builder
+	for i := 1; i < 100; i++ {
+		fmt.Fprintf(&source, "P%d -> P%d: %s\n", i-1, i, strings.Repeat("x", 1000))
+	}
+	source.WriteString(strings.Repeat("P0 -> P99: x\n", 1000))
+	r, err := NewRenderer(WithFormat(FORMAT_TXT), WithLimits(DefaultLimits()))
+	assert.NoError(t, err)
+	_, _, err = r.Render(source.String())
+	assert.Equal(t, LimitError{Limit: LIMIT_TEXT_CELLS, Max: DefaultLimits().MaxTextCells}, err)
+}
+
+func TestRenderContext(t *testing.T) {
+	source := strings.Repeat("A -> B: hello\n", 100)
+	r, err := NewRenderer()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = r.RenderContext(ctx, source)
+	assert.Equal(t, context.Canceled, err)
+	_, err = ValidateContext(ctx, source, DefaultConfig(), Limits{})
+	assert.Equal(t, context.Canceled, err)
+
+	// layout checks the context too.
+	d := r.NewDiagram()
+	assert.NoError(t, d.Parse(source))
+	ctx, cancel = context.WithCancel(context.Background())
+	d.ctx = ctx
+	cancel()
+	assert.Equal(t, context.Canceled, d.Layout())
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, _, err = CreateDiagramContext(ctx, source, DefaultConfig(), Limits{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	data, _, err := r.RenderContext(context.Background(), source)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+}
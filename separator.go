@@ -0,0 +1,163 @@
+package sequence
+
+import (
+	"go-sequencediagrams/utils"
+	"golang.org/x/image/font"
+)
+
+// separators are the sequences that span the whole diagram ( delays, dividers & spacing )
+// they don't belong to a participant and only take up vertical space.
+type BaseSeparator struct {
+	message  string
+	position utils.Rectangle
+	index    int
+	seqType  int
+}
+
+type Delay struct {
+	BaseSeparator
+}
+
+type Divider struct {
+	BaseSeparator
+}
+
+type Space struct {
+	BaseSeparator
+	height int
+}
+
+func (bs *BaseSeparator) Type() int {
+	return bs.seqType
+}
+
+func (bs *BaseSeparator) PrimaryParticipant() *Participant {
+	return nil
+}
+
+func (bs *BaseSeparator) SecondaryParticipant() *Participant {
+	return nil
+}
+
+func (bs *BaseSeparator) Text() string {
+	return bs.message
+}
+
+func (bs *BaseSeparator) SetPosition(rectangle utils.Rectangle) {
+	bs.position = rectangle
+}
+
+func (bs *BaseSeparator) Position() utils.Rectangle {
+	return bs.position
+}
+
+func (bs *BaseSeparator) IsStartProcess() bool {
+	return false
+}
+
+func (bs *BaseSeparator) IsEndProcess() bool {
+	return false
+}
+
+func (bs *BaseSeparator) SetStartProcess(*Process) {
+	return
+}
+
+func (bs *BaseSeparator) SetEndProcess(*Process) {
+	return
+}
+
+func (bs *BaseSeparator) Index() int {
+	return bs.index
+}
+
+func (bs *BaseSeparator) Init(data map[string]interface{}, d *Diagram, index int, seqType int) error {
+	bs.index = index
+	bs.message = data["text"].(string)
+	bs.seqType = seqType
+	return nil
+}
+
+func (bs *BaseSeparator) MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle {
+	if len(bs.message) == 0 {
+		return utils.Rect(0, 0, 0, 0)
+	}
+	dc := d.dc
+	dc.Push()
+	defer dc.Pop()
+	dc.SetFontFace(sequenceFont)
+	w, h := dc.MeasureString(bs.message)
+	w += CONFIG_TEXT_PADDING_X * 2
+	h += CONFIG_TEXT_PADDING_Y * 2
+
+	return utils.Rect(0, 0, int(w), int(h))
+}
+
+func (bs *BaseSeparator) Render(d *Diagram, dc Canvas) {
+}
+
+func (dl *Delay) MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle {
+	r := dl.BaseSeparator.MeasureBounds(d, sequenceFont)
+	return utils.Rect(0, 0, r.Dx(), r.Dy()+CONFIG_DELAY_HEIGHT)
+}
+
+func (dl *Delay) Render(d *Diagram, dc Canvas) {
+	// the lifelines are broken by RenderParticipantLines, we only need the text.
+	if len(dl.message) == 0 {
+		return
+	}
+	dc.Push()
+	defer dc.Pop()
+	dc.SetFontFace(d.SequenceFont)
+	dc.SetColor(d.theme.SeparatorText)
+	width, _ := d.ComputeImageSize()
+	dc.DrawStringAnchored(dl.message, float64(width)/2, float64(dl.position.MidY()), 0.5, 0.5)
+}
+
+func (dv *Divider) MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle {
+	r := dv.BaseSeparator.MeasureBounds(d, sequenceFont)
+	if r.Dy() < CONFIG_DIVIDER_HEIGHT {
+		r = utils.Rect(0, 0, r.Dx(), CONFIG_DIVIDER_HEIGHT)
+	}
+	return r
+}
+
+func (dv *Divider) Render(d *Diagram, dc Canvas) {
+	dc.Push()
+	defer dc.Pop()
+	y := float64(dv.position.MidY())
+	imageWidth, _ := d.ComputeImageSize()
+	width := float64(imageWidth)
+
+	// double line across the whole diagram.
+	dc.SetColor(d.theme.SeparatorLine)
+	dc.DrawLine(0, y-CONFIG_DIVIDER_GAP/2, width, y-CONFIG_DIVIDER_GAP/2)
+	dc.DrawLine(0, y+CONFIG_DIVIDER_GAP/2, width, y+CONFIG_DIVIDER_GAP/2)
+	dc.Stroke()
+
+	if len(dv.message) == 0 {
+		return
+	}
+	dc.SetFontFace(d.SequenceFont)
+	w, h := dc.MeasureString(dv.message)
+	w += CONFIG_TEXT_PADDING_X * 2
+	h += CONFIG_TEXT_PADDING_Y * 2
+	dc.DrawRectangle(width/2-w/2, y-h/2, w, h)
+	dc.SetColor(d.theme.SeparatorFill)
+	dc.FillPreserve()
+	dc.SetColor(d.theme.SeparatorLine)
+	dc.Stroke()
+
+	dc.SetColor(d.theme.SeparatorText)
+	dc.DrawStringAnchored(dv.message, width/2, y, 0.5, 0.5)
+}
+
+func (sp *Space) Init(data map[string]interface{}, d *Diagram, index int, seqType int) error {
+	sp.BaseSeparator.Init(data, d, index, seqType)
+	sp.height = int(data["height"].(float64))
+	return nil
+}
+
+func (sp *Space) MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle {
+	return utils.Rect(0, 0, 0, sp.height)
+}
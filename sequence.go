@@ -14,7 +14,7 @@ type Sequence interface {
 	SecondaryParticipant() *Participant
 	SetPosition(rectangle utils.Rectangle)
 	Position() utils.Rectangle
-	Render(d *Diagram, dc *gg.Context)
+	Render(d *Diagram, dc Canvas)
 	MeasureBounds(d *Diagram, sequenceFont font.Face) utils.Rectangle
 
 	IsStartProcess() bool
@@ -41,6 +41,8 @@ type BaseSequence struct {
 	index        int
 
 	seqType int
+	// url the message links to, empty without one.
+	link string
 }
 
 func (s *BaseSequence) Type() int {
@@ -73,6 +75,7 @@ func (s *BaseSequence) Init(data map[string]interface{}, d *Diagram, index int,
 	s.primary = d.GetOrCreateParticipant(data["src"].(string))
 	s.secondary = d.GetOrCreateParticipant(data["dest"].(string))
 	s.message = data["text"].(string)
+	s.link, _ = data["link"].(string)
 	s.seqType = seqType
 	s.index = index
 	return nil
@@ -116,23 +119,23 @@ type SolidSequence struct {
 	BaseSequence
 }
 
-func (s *SolidSequence) Render(d *Diagram, dc *gg.Context) {
+func (s *SolidSequence) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, false)
 }
 
-func (s *StartProcess) Render(d *Diagram, dc *gg.Context) {
+func (s *StartProcess) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, false)
 }
 
-func (s *EndProcess) Render(d *Diagram, dc *gg.Context) {
+func (s *EndProcess) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, false)
 }
 
-func (s *StartDottedProcess) Render(d *Diagram, dc *gg.Context) {
+func (s *StartDottedProcess) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, true)
 }
 
-func (s *EndDottedProcess) Render(d *Diagram, dc *gg.Context) {
+func (s *EndDottedProcess) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, true)
 }
 
@@ -140,7 +143,7 @@ type DottedSequence struct {
 	BaseSequence
 }
 
-func (s *DottedSequence) Render(d *Diagram, dc *gg.Context) {
+func (s *DottedSequence) Render(d *Diagram, dc Canvas) {
 	s.RenderSequence(d, dc, true)
 }
 
@@ -176,27 +179,88 @@ func (s *EndDottedProcess) IsEndProcess() bool {
 	return true
 }
 
-// zero angle is >
-func (b *BaseSequence) DrawArrow(dc *gg.Context, width float64, height float64, x int, y int, angle float64) {
-	adc := gg.NewContext(int(width), int(height))
-	// set transparent background
-	adc.SetHexColor("ffffff00")
-	adc.Clear()
-
-	adc.MoveTo(0, 0)
-	adc.LineTo(width, height/2)
-	adc.LineTo(0, height)
-	adc.ClosePath()
-	adc.SetColor(CONFIG_SEQUENCE_LINE_COLOR)
-	adc.FillPreserve()
-	adc.Stroke()
+// zero angle is >, the arrow is drawn in the current color.
+func (b *BaseSequence) DrawArrow(dc Canvas, width float64, height float64, x int, y int, angle float64) {
 	dc.Push()
-	dc.RotateAbout(gg.Radians(angle), float64(x), float64(y))
-	dc.DrawImage(adc.Image(), x, y-int(height/2))
-	dc.Pop()
+	defer dc.Pop()
+
+	// triangle pointing right from x,y rotated about x,y.
+	sin, cos := math.Sincos(gg.Radians(angle))
+	points := [][2]float64{{0, -height / 2}, {width, 0}, {0, height / 2}}
+	for idx, p := range points {
+		px := float64(x) + p[0]*cos - p[1]*sin
+		py := float64(y) + p[0]*sin + p[1]*cos
+		if idx == 0 {
+			dc.MoveTo(px, py)
+		} else {
+			dc.LineTo(px, py)
+		}
+	}
+	dc.ClosePath()
+	dc.SetDash()
+	dc.FillPreserve()
+	dc.Stroke()
+}
+
+// selfEnds is where the loop of a message to its own participant starts and how far right it
+// reaches, before the arc.
+func (b BaseSequence) selfEnds(d *Diagram) (float64, float64) {
+	p1 := b.primary.position
+	x1 := float64(p1.Min.X + p1.Dx()/2)
+
+	// first we check if we are starting a process
+	process := d.GetProcessAtSequence(b.primary, b.index)
+	if process != nil {
+		x1 = float64(process.position.Max.X)
+	}
+	return x1, x1 + float64(b.position.Dx())/2
+}
+
+// lineEnds is where the line of a message leaves its primary and reaches its secondary, on
+// the edges of their processes. isReverse when the secondary is left of the primary.
+func (b BaseSequence) lineEnds(d *Diagram) (float64, float64, bool) {
+	p1 := b.primary.position
+	p2 := b.secondary.position
+	x1 := float64(p1.Min.X + p1.Dx()/2)
+	x2 := float64(p2.Min.X + p2.Dx()/2)
+
+	isReverse := false
+	if x1 > x2 {
+		isReverse = true
+	}
+
+	process := d.GetProcessAtSequence(b.primary, b.index)
+	if process != nil {
+		if isReverse {
+			x1 = float64(process.position.Min.X)
+		} else {
+			x1 = float64(process.position.Max.X)
+		}
+	}
+
+	process = d.GetProcessAtSequence(b.secondary, b.index)
+	if process != nil {
+		if isReverse {
+			x2 = float64(process.position.Max.X)
+		} else {
+			x2 = float64(process.position.Min.X)
+		}
+	}
+	return x1, x2, isReverse
+}
+
+// DrawnPosition is the part of the diagram the message covers once the participants are
+// placed, Position only holds its height.
+func (b *BaseSequence) DrawnPosition(d *Diagram) utils.Rectangle {
+	if b.primary == b.secondary {
+		x1, x2 := b.selfEnds(d)
+		return utils.Rect(int(x1), b.position.Min.Y, int(x2)+CONFIG_SELF_DIAMETER/2, b.position.Max.Y)
+	}
+	x1, x2, _ := b.lineEnds(d)
+	return utils.Rect(int(x1), b.position.Min.Y, int(x2), b.position.Max.Y)
 }
 
-func (b BaseSequence) RenderSequence(d *Diagram, dc *gg.Context, isDotted bool) {
+func (b BaseSequence) RenderSequence(d *Diagram, dc Canvas, isDotted bool) {
 
 	dc.Push()
 	defer dc.Pop()
@@ -206,19 +270,11 @@ func (b BaseSequence) RenderSequence(d *Diagram, dc *gg.Context, isDotted bool)
 		// we draw a line and a semi circle and we come back and end at the same participant
 		// we then draw the text over it.
 
-		p1 := b.primary.position
-		x1 := float64(p1.Min.X + p1.Dx()/2)
-
-		// first we check if we are starting a process
-		process := d.GetProcessAtSequence(b.primary, b.index)
-		if process != nil {
-			x1 = float64(process.position.Max.X)
-		}
-
-		x2 := x1 + float64(b.position.Dx())/2
+		x1, x2 := b.selfEnds(d)
 		if isDotted {
 			dc.SetDash(5, 5)
 		}
+		dc.SetColor(d.theme.MessageLine)
 		dc.DrawLine(x1, float64(b.position.Min.Y), x2, float64(b.position.Min.Y))
 		dc.Stroke()
 		dc.DrawEllipticalArc(x2, float64(b.position.Min.Y)+CONFIG_SELF_DIAMETER/2, CONFIG_SELF_DIAMETER/2, CONFIG_SELF_DIAMETER/2, gg.Radians(90), gg.Radians(-90))
@@ -228,10 +284,11 @@ func (b BaseSequence) RenderSequence(d *Diagram, dc *gg.Context, isDotted bool)
 
 		arrowStartX := x1 + CONFIG_ARROW_WIDTH
 		arrowAngle := 180.0
+		dc.SetColor(d.theme.Arrow)
 		b.DrawArrow(dc, CONFIG_ARROW_WIDTH, CONFIG_ARROW_HEIGHT, int(arrowStartX), b.position.Min.Y+CONFIG_SELF_DIAMETER, arrowAngle)
 
 		dc.SetFontFace(d.SequenceFont)
-		dc.SetRGB(0, 0, 0)
+		dc.SetColor(d.theme.MessageText)
 		dc.DrawStringAnchored(b.message, x2, float64(b.position.Min.Y), 0.5, -0.2)
 
 		return
@@ -241,34 +298,8 @@ func (b BaseSequence) RenderSequence(d *Diagram, dc *gg.Context, isDotted bool)
 			dc.SetDash(5, 5)
 		}
 
-		p1 := b.primary.position
-		p2 := b.secondary.position
-		x1 := float64(p1.Min.X + p1.Dx()/2)
 		y := float64(b.position.Min.Y + b.position.Dy()/2)
-		x2 := float64(p2.Min.X + p2.Dx()/2)
-
-		isReverse := false
-		if x1 > x2 {
-			isReverse = true
-		}
-
-		process := d.GetProcessAtSequence(b.primary, b.index)
-		if process != nil {
-			if isReverse {
-				x1 = float64(process.position.Min.X)
-			} else {
-				x1 = float64(process.position.Max.X)
-			}
-		}
-
-		process = d.GetProcessAtSequence(b.secondary, b.index)
-		if process != nil {
-			if isReverse {
-				x2 = float64(process.position.Max.X)
-			} else {
-				x2 = float64(process.position.Min.X)
-			}
-		}
+		x1, x2, isReverse := b.lineEnds(d)
 
 		arrowStartX := x2 - CONFIG_ARROW_WIDTH
 
@@ -282,12 +313,13 @@ func (b BaseSequence) RenderSequence(d *Diagram, dc *gg.Context, isDotted bool)
 		}
 		centerX := x1 + math.Abs(x2-x1)/2
 
-		dc.SetRGB(0, 0, 0xff)
+		dc.SetColor(d.theme.MessageLine)
 		dc.DrawLine(x1, y, x2, y)
 		dc.Stroke()
 		dc.SetFontFace(d.SequenceFont)
+		dc.SetColor(d.theme.Arrow)
 		b.DrawArrow(dc, CONFIG_ARROW_WIDTH, CONFIG_ARROW_HEIGHT, int(arrowStartX), int(y), arrowAngle)
-		dc.SetRGB(0, 0, 0)
+		dc.SetColor(d.theme.MessageText)
 		dc.DrawStringAnchored(b.message, centerX, y, 0.5, -0.2)
 
 	}
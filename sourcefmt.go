@@ -0,0 +1,208 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SOURCE_INDENT is the indentation of one nesting level ( alt, loop and box blocks ).
+const SOURCE_INDENT = "  "
+
+var messageArrows = map[int]string{
+	ST_SOLID:                "->",
+	ST_DOTTED:               "-->",
+	ST_START_PROCESS:        "->+",
+	ST_END_PROCESS:          "->-",
+	ST_START_DOTTED_PROCESS: "-->+",
+	ST_END_DOTTED_PROCESS:   "-->-",
+}
+
+// FormatOptions are the choices of the formatter that aren't fixed, the zero value is what
+// FormatSource does.
+type FormatOptions struct {
+	// AlignColons pads the messages of a block so their colons line up.
+	AlignColons bool `json:"align_colons"`
+}
+
+// formattedLine is a statement of the output, colon is the offset of the colon of a message
+// or -1.
+type formattedLine struct {
+	level int
+	text  string
+	colon int
+}
+
+// FormatSource pretty prints a diagram source: statements are trimmed and indented by their
+// nesting, messages are spaced as "A -> B: text" and runs of blank lines are collapsed. Lines
+// that don't parse are only re-indented, so formatting never changes what a source means.
+func FormatSource(source string) string {
+	return FormatOptions{}.Format(source)
+}
+
+// Format pretty prints a diagram source like FormatSource, with the options.
+func (opts FormatOptions) Format(source string) string {
+	lines := strings.Split(strings.Replace(source, "\r\n", "\n", -1), "\n")
+	// nil entries are blank lines.
+	var out []*formattedLine
+	depth := 0
+	blank := false
+	for _, line := range lines {
+		text := strings.TrimSpace(line)
+		if len(text) == 0 {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, nil)
+			blank = false
+		}
+
+		formatted, typ := formatStatement(strings.TrimLeft(line, " \t"))
+		level := depth
+		switch typ {
+		case ST_GROUP_MESSAGE, ST_BOX_START:
+			depth++
+		case ST_END_GROUP, ST_BOX_END:
+			if depth > 0 {
+				depth--
+			}
+			level = depth
+		case ST_ELSE_MESSAGE:
+			if level > 0 {
+				level--
+			}
+		}
+		colon := -1
+		if _, ok := messageArrows[typ]; ok {
+			colon = strings.Index(formatted, ":")
+		}
+		out = append(out, &formattedLine{level: level, text: formatted, colon: colon})
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	if opts.AlignColons {
+		alignColons(out)
+	}
+
+	result := make([]string, len(out))
+	for i, l := range out {
+		if l != nil {
+			result[i] = strings.Repeat(SOURCE_INDENT, l.level) + l.text
+		}
+	}
+	return strings.Join(result, "\n") + "\n"
+}
+
+// alignColons pads the messages of every run of consecutive messages at the same level to the
+// widest "A -> B" of the run.
+func alignColons(lines []*formattedLine) {
+	for start := 0; start < len(lines); {
+		if lines[start] == nil || lines[start].colon < 0 {
+			start++
+			continue
+		}
+		end := start
+		width := 0
+		for ; end < len(lines) && lines[end] != nil && lines[end].colon >= 0 && lines[end].level == lines[start].level; end++ {
+			if n := utf8.RuneCountInString(lines[end].text[:lines[end].colon]); n > width {
+				width = n
+			}
+		}
+		for _, l := range lines[start:end] {
+			head := l.text[:l.colon]
+			l.text = head + strings.Repeat(" ", width-utf8.RuneCountInString(head)) + l.text[l.colon:]
+		}
+		start = end
+	}
+}
+
+// formatStatement normalises a single statement and returns its type, 0 when it doesn't parse.
+// A statement that would parse differently once normalised ( "alt " needs its space ) is kept.
+func formatStatement(text string) (string, int) {
+	jsonstr, typ, err := ParseLine(text)
+	if err != nil {
+		return strings.TrimSpace(text), 0
+	}
+	formatted := normalizeStatement(strings.TrimSpace(text), jsonstr, typ)
+	if _, t, err := ParseLine(formatted); err != nil || t != typ {
+		return strings.TrimRight(text, "\r"), typ
+	}
+	return formatted, typ
+}
+
+func normalizeStatement(text string, jsonstr string, typ int) string {
+	var seq map[string]interface{}
+	if json.Unmarshal([]byte(jsonstr), &seq) != nil {
+		return text
+	}
+	if statement, ok := statementSource(typ, seq); ok {
+		return statement
+	}
+	return text
+}
+
+// statementSource writes a statement ( the json of ParseLine as a map ) in the source syntax,
+// it fails for the types that have no statement of their own.
+func statementSource(typ int, seq map[string]interface{}) (string, bool) {
+	field := func(name string) string {
+		v, _ := seq[name].(string)
+		return strings.TrimSpace(v)
+	}
+
+	if arrow, ok := messageArrows[typ]; ok {
+		return fmt.Sprintf("%s %s %s: %s", field("src"), arrow, field("dest"), field("text")) + linkSuffix(field("link")), true
+	}
+	switch typ {
+	case ST_PARTICIPANT:
+		return "participant " + field("name") + linkSuffix(field("link")), true
+	case ST_GROUP_MESSAGE:
+		return field("name") + " " + field("text"), true
+	case ST_ELSE_MESSAGE:
+		return "else " + field("text"), true
+	case ST_END_GROUP:
+		return "end", true
+	case ST_BOX_END:
+		return "end box", true
+	case ST_BOX_START:
+		box := "box"
+		if name := field("text"); len(name) > 0 {
+			box += ` "` + name + `"`
+		}
+		if color := field("color"); len(color) > 0 {
+			box += " " + color
+		}
+		return box, true
+	case ST_REF:
+		var keys []string
+		if names, ok := seq["src"].([]interface{}); ok {
+			for _, n := range names {
+				name, _ := n.(string)
+				keys = append(keys, strings.TrimSpace(name))
+			}
+		}
+		statement := "ref over " + strings.Join(keys, ", ") + ": " + field("text")
+		if target := field("target"); len(target) > 0 {
+			statement += " [[" + target + "]]"
+		}
+		return statement, true
+	case ST_DELAY:
+		if text := field("text"); len(text) > 0 {
+			return "... " + text + " ...", true
+		}
+		return "...", true
+	case ST_DIVIDER:
+		if name := field("text"); len(name) > 0 {
+			return "== " + name + " ==", true
+		}
+		return "== ==", true
+	case ST_SPACE:
+		if height, _ := seq["height"].(float64); height != CONFIG_SPACE_HEIGHT {
+			return fmt.Sprintf("||%d||", int(height)), true
+		}
+		return "|||", true
+	}
+	return "", false
+}
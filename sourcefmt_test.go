@@ -0,0 +1,47 @@
+package sequence
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	src := "\n\n  A->B :  hi there  \nalt  yes\n   B-->+A:x\nloop \n else \n  end\n\n\n end \nbox \"Backend\"   #red\nparticipant    C\n  end   box\nnot a statement  \n==   ==\n\n"
+	expected := "A -> B: hi there\nalt yes\n  B -->+ A: x\n  loop \n  else \n  end\n\nend\nbox \"Backend\" #red\n  participant C\nend box\nnot a statement\n== ==\n"
+	assert.Equal(t, expected, FormatSource(src))
+	assert.Equal(t, expected, FormatSource(expected), "formatting is idempotent")
+	assert.Equal(t, "", FormatSource("\n  \n"))
+
+	// formatting doesn't change the diagram.
+	src = "participant B\n  A ->+ B:hello\nalt ok\nB-->-A : done\nend"
+	before, err := Validate(src, DefaultConfig())
+	assert.NoError(t, err)
+	after, err := Validate(FormatSource(src), DefaultConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, before.Participants, after.Participants)
+	assert.Equal(t, before.Messages, after.Messages)
+	assert.True(t, after.Valid)
+}
+
+func TestFormatSourceBoxNames(t *testing.T) {
+	src := `box  "Back-end (EU), C:\dir"  #red`
+	assert.Equal(t, "box \"Back-end (EU), C:\\dir\" #red\n", FormatSource(src))
+	assert.Equal(t, FormatSource(src), FormatSource(FormatSource(src)))
+}
+
+func TestFormatSourceStatements(t *testing.T) {
+	src := fmt.Sprintf("ref over A,B : Login [[login]]\n...\n...  later ...\n||%d||\n ||40|| \n", CONFIG_SPACE_HEIGHT)
+	assert.Equal(t, "ref over A, B: Login [[login]]\n...\n... later ...\n|||\n||40||\n", FormatSource(src))
+	// notes aren't supported, they are only trimmed.
+	assert.Equal(t, "note over  A ,B :  hi\n", FormatSource("  note over  A ,B :  hi \n"))
+}
+
+func TestFormatSourceAlignColons(t *testing.T) {
+	src := "Alice->Bob:hi\nA-->+B : y\nnote over A: n\nA->B:z\nalt ok\n  Bob->A:x\n  A->-Bob:y\nend\n\nBob->A:after"
+	expected := "Alice -> Bob: hi\nA -->+ B    : y\nnote over A: n\nA -> B: z\nalt ok\n  Bob -> A : x\n  A ->- Bob: y\nend\n\nBob -> A: after\n"
+	opts := FormatOptions{AlignColons: true}
+	assert.Equal(t, expected, opts.Format(src))
+	assert.Equal(t, expected, opts.Format(expected))
+	assert.Equal(t, "A -> B: y\n", opts.Format("A->B:y"))
+}
@@ -0,0 +1,49 @@
+package sequence
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MAX_DECODED_SOURCE_BYTES stops a small url from inflating into a huge source.
+const MAX_DECODED_SOURCE_BYTES = 1 << 20
+
+// EncodeSource deflates the source and encodes it as unpadded base64url so it can be used as a
+// path segment ( GET /api/v1/sequence/png/{encoded} ).
+func EncodeSource(source string) (string, error) {
+	buf := new(bytes.Buffer)
+	w, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(source)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeSource reverses EncodeSource, padding is accepted as some encoders add it.
+func DecodeSource(encoded string) (string, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return "", fmt.Errorf("Invalid encoded source: %s", err.Error())
+	}
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, MAX_DECODED_SOURCE_BYTES+1))
+	if err != nil {
+		return "", fmt.Errorf("Invalid encoded source: %s", err.Error())
+	}
+	if len(data) > MAX_DECODED_SOURCE_BYTES {
+		return "", fmt.Errorf("Encoded source is larger than %d bytes", MAX_DECODED_SOURCE_BYTES)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,33 @@
+package sequence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSource(t *testing.T) {
+	src := "title Login\nAlice -> Bob: hello ü\nBob --> Alice: ok\n"
+	encoded, err := EncodeSource(src)
+	assert.NoError(t, err)
+	assert.False(t, strings.ContainsAny(encoded, "+/="), "encoded source must be url safe")
+
+	decoded, err := DecodeSource(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, src, decoded)
+
+	// padded input from other encoders.
+	decoded, err = DecodeSource(encoded + "==")
+	assert.NoError(t, err)
+	assert.Equal(t, src, decoded)
+
+	_, err = DecodeSource("not*base64")
+	assert.Error(t, err)
+	_, err = DecodeSource("aGVsbG8")
+	assert.Error(t, err, "not deflate data")
+
+	big, err := EncodeSource(strings.Repeat("A -> B: hello\n", MAX_DECODED_SOURCE_BYTES/10))
+	assert.NoError(t, err)
+	_, err = DecodeSource(big)
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package sequence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StoredDiagram is one revision of a diagram source kept for a tenant with the outputs rendered from it.
+type StoredDiagram struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	// revisions are numbered from 1, every save adds one.
+	Revision int               `json:"revision"`
+	Author   string            `json:"author"`
+	Source   string            `json:"source"`
+	Outputs  map[string][]byte `json:"outputs"`
+	Warnings []Diagnostic      `json:"warnings"`
+	// when this revision was saved.
+	Created time.Time `json:"created"`
+}
+
+// RevisionInfo describes a revision without its source and outputs.
+type RevisionInfo struct {
+	Revision int       `json:"revision"`
+	Author   string    `json:"author"`
+	Created  time.Time `json:"created"`
+}
+
+func (sd *StoredDiagram) Info() RevisionInfo {
+	return RevisionInfo{Revision: sd.Revision, Author: sd.Author, Created: sd.Created}
+}
+
+// Clone copies the diagram so callers can't change what is stored.
+func (sd *StoredDiagram) Clone() *StoredDiagram {
+	c := *sd
+	c.Outputs = make(map[string][]byte, len(sd.Outputs))
+	for format, data := range sd.Outputs {
+		c.Outputs[format] = data
+	}
+	c.Warnings = append([]Diagnostic(nil), sd.Warnings...)
+	return &c
+}
+
+// DiagramStore keeps diagrams per tenant, a diagram is never visible to another tenant.
+// Saving never overwrites, every save of a diagram adds a revision to its history.
+type DiagramStore interface {
+	// Save stores the diagram under tenantID as its next revision, an empty ID is assigned a new one.
+	Save(tenantID string, d *StoredDiagram) error
+	// Get returns the latest revision.
+	Get(tenantID string, id string) (*StoredDiagram, error)
+	GetRevision(tenantID string, id string, revision int) (*StoredDiagram, error)
+	// Revisions lists the history of a diagram, oldest first.
+	Revisions(tenantID string, id string) ([]RevisionInfo, error)
+}
+
+var ErrDiagramNotFound = fmt.Errorf("Diagram not found")
+var ErrRevisionNotFound = fmt.Errorf("Revision not found")
+
+var storeKeyFormat = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// ValidateStoreKey checks tenant ids and diagram ids, they end up in file names.
+func ValidateStoreKey(kind string, key string) error {
+	if !storeKeyFormat.MatchString(key) {
+		return fmt.Errorf("Invalid %s %q", kind, key)
+	}
+	return nil
+}
+
+// ParseRevision reads a revision number from a path or query parameter.
+func ParseRevision(s string) (int, error) {
+	revision, err := strconv.Atoi(s)
+	if err != nil || revision < 1 {
+		return 0, fmt.Errorf("Invalid revision %q", s)
+	}
+	return revision, nil
+}
+
+func NewDiagramID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// prepareSave validates the keys and fills in the id, tenant and creation time, the
+// revision number is left to the store.
+func prepareSave(tenantID string, d *StoredDiagram) error {
+	if err := ValidateStoreKey("tenant", tenantID); err != nil {
+		return err
+	}
+	if len(d.ID) == 0 {
+		id, err := NewDiagramID()
+		if err != nil {
+			return err
+		}
+		d.ID = id
+	}
+	if err := ValidateStoreKey("diagram id", d.ID); err != nil {
+		return err
+	}
+	d.TenantID = tenantID
+	if d.Created.IsZero() {
+		d.Created = time.Now().UTC()
+	}
+	return nil
+}
+
+type MemoryStore struct {
+	mutex sync.RWMutex
+	// tenant -> diagram id -> revisions, oldest first.
+	diagrams map[string]map[string][]*StoredDiagram
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{diagrams: make(map[string]map[string][]*StoredDiagram)}
+}
+
+func (ms *MemoryStore) Save(tenantID string, d *StoredDiagram) error {
+	if err := prepareSave(tenantID, d); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	tenant, ok := ms.diagrams[tenantID]
+	if !ok {
+		tenant = make(map[string][]*StoredDiagram)
+		ms.diagrams[tenantID] = tenant
+	}
+	d.Revision = len(tenant[d.ID]) + 1
+	tenant[d.ID] = append(tenant[d.ID], d.Clone())
+	return nil
+}
+
+func (ms *MemoryStore) Get(tenantID string, id string) (*StoredDiagram, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	revisions, ok := ms.diagrams[tenantID][id]
+	if !ok {
+		return nil, ErrDiagramNotFound
+	}
+	return revisions[len(revisions)-1].Clone(), nil
+}
+
+func (ms *MemoryStore) GetRevision(tenantID string, id string, revision int) (*StoredDiagram, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	revisions, ok := ms.diagrams[tenantID][id]
+	if !ok {
+		return nil, ErrDiagramNotFound
+	}
+	if revision < 1 || revision > len(revisions) {
+		return nil, ErrRevisionNotFound
+	}
+	return revisions[revision-1].Clone(), nil
+}
+
+func (ms *MemoryStore) Revisions(tenantID string, id string) ([]RevisionInfo, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	revisions, ok := ms.diagrams[tenantID][id]
+	if !ok {
+		return nil, ErrDiagramNotFound
+	}
+	infos := make([]RevisionInfo, 0, len(revisions))
+	for _, r := range revisions {
+		infos = append(infos, r.Info())
+	}
+	return infos, nil
+}
@@ -0,0 +1,173 @@
+package sequence
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testDiagramStore(t *testing.T, store DiagramStore) {
+	d := StoredDiagram{Source: "A -> B: hello", Outputs: map[string][]byte{FORMAT_PNG: []byte("png")}}
+	assert.NoError(t, store.Save("tenant1", &d))
+	assert.NotEmpty(t, d.ID)
+	assert.Equal(t, "tenant1", d.TenantID)
+	assert.False(t, d.Created.IsZero())
+
+	got, err := store.Get("tenant1", d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, d.Source, got.Source)
+	assert.Equal(t, []byte("png"), got.Outputs[FORMAT_PNG])
+
+	// other tenants can't see it.
+	_, err = store.Get("tenant2", d.ID)
+	assert.Equal(t, ErrDiagramNotFound, err)
+	_, err = store.Get("tenant1", "missing")
+	assert.Equal(t, ErrDiagramNotFound, err)
+
+	// keys end up in paths.
+	assert.Error(t, store.Save("../tenant", &StoredDiagram{Source: "x"}))
+	assert.Error(t, store.Save("tenant1", &StoredDiagram{ID: "../../x", Source: "x"}))
+	_, err = store.Get("../tenant1", d.ID)
+	assert.Error(t, err)
+
+	// saving again adds a revision.
+	assert.Equal(t, 1, d.Revision)
+	update := StoredDiagram{ID: d.ID, Author: "alice", Source: "A -> C: hello"}
+	assert.NoError(t, store.Save("tenant1", &update))
+	assert.Equal(t, 2, update.Revision)
+
+	got, err = store.Get("tenant1", d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got.Revision)
+	assert.Equal(t, "alice", got.Author)
+	assert.Equal(t, "A -> C: hello", got.Source)
+
+	got, err = store.GetRevision("tenant1", d.ID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "A -> B: hello", got.Source)
+	_, err = store.GetRevision("tenant1", d.ID, 3)
+	assert.Equal(t, ErrRevisionNotFound, err)
+	_, err = store.GetRevision("tenant2", d.ID, 1)
+	assert.Equal(t, ErrDiagramNotFound, err)
+
+	revisions, err := store.Revisions("tenant1", d.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 1, revisions[0].Revision)
+		assert.Equal(t, 2, revisions[1].Revision)
+		assert.Equal(t, "alice", revisions[1].Author)
+	}
+	_, err = store.Revisions("tenant2", d.ID)
+	assert.Equal(t, ErrDiagramNotFound, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testDiagramStore(t, store)
+
+	// changing a returned diagram doesn't change the stored one.
+	d := StoredDiagram{Source: "A -> B: hello", Outputs: map[string][]byte{}}
+	assert.NoError(t, store.Save("tenant1", &d))
+	got, _ := store.Get("tenant1", d.ID)
+	got.Outputs[FORMAT_SVG] = []byte("svg")
+	got, _ = store.Get("tenant1", d.ID)
+	assert.Empty(t, got.Outputs)
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+	testDiagramStore(t, store)
+}
+
+func TestDiffLines(t *testing.T) {
+	lines := DiffLines("A -> B: hello\nB -> A: ok\n", "A -> B: hello\nB -> C: ok\nC -> A: done")
+	assert.Equal(t, []DiffLine{
+		{Op: DIFF_EQUAL, Text: "A -> B: hello"},
+		{Op: DIFF_DELETE, Text: "B -> A: ok"},
+		{Op: DIFF_INSERT, Text: "B -> C: ok"},
+		{Op: DIFF_INSERT, Text: "C -> A: done"},
+	}, lines)
+
+	assert.Empty(t, DiffLines("", ""))
+	assert.Equal(t, []DiffLine{{Op: DIFF_INSERT, Text: "A -> B"}}, DiffLines("", "A -> B"))
+}
+
+// lcsLength is the length of the longest common subsequence of a and b, the shortest diff keeps
+// as many lines.
+func lcsLength(a []string, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string('a' + rune(r.Intn(4)))
+		}
+		return lines
+	}
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+		var from, to []string
+		equal := 0
+		for _, line := range DiffLines(strings.Join(a, "\n"), strings.Join(b, "\n")) {
+			switch line.Op {
+			case DIFF_EQUAL:
+				equal++
+				from = append(from, line.Text)
+				to = append(to, line.Text)
+			case DIFF_DELETE:
+				from = append(from, line.Text)
+			case DIFF_INSERT:
+				to = append(to, line.Text)
+			}
+		}
+		assert.Equal(t, strings.Join(a, "\n"), strings.Join(from, "\n"))
+		assert.Equal(t, strings.Join(b, "\n"), strings.Join(to, "\n"))
+		assert.Equal(t, lcsLength(a, b), equal, "%q %q", a, b)
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// a table of every pair of lines would be 10^10 cells.
+	a := make([]string, 100000)
+	b := make([]string, 100000)
+	for i := range a {
+		a[i] = fmt.Sprintf("A -> B: %d", i)
+		b[i] = fmt.Sprintf("B -> A: %d", i)
+	}
+	lines := DiffLines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	assert.Len(t, lines, 200000)
+	assert.Equal(t, DiffLine{Op: DIFF_DELETE, Text: "A -> B: 0"}, lines[0])
+	assert.Equal(t, DiffLine{Op: DIFF_INSERT, Text: "B -> A: 0"}, lines[100000])
+
+	b = append(append([]string{}, a[:50000]...), append([]string{"C -> A: new"}, a[50000:]...)...)
+	lines = DiffLines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	assert.Len(t, lines, 100001)
+	assert.Equal(t, DiffLine{Op: DIFF_INSERT, Text: "C -> A: new"}, lines[50000])
+}
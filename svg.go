@@ -0,0 +1,233 @@
+package sequence
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"html"
+	"image/color"
+	"math"
+	"strings"
+)
+
+type svgState struct {
+	color    color.Color
+	dash     []float64
+	fontFace font.Face
+}
+
+// SVGCanvas records the drawing calls as svg elements. Text is measured with the same font
+// faces as the raster output so the layout matches, the sizes of the faces are needed to
+// write the font-size of the text.
+type SVGCanvas struct {
+	width  int
+	height int
+	// the svg is scale times its viewBox.
+	scale     float64
+	fontSizes map[font.Face]float64
+	measure   *gg.Context
+
+	state svgState
+	stack []svgState
+	path  strings.Builder
+	body  bytes.Buffer
+}
+
+func NewSVGCanvas(width int, height int, fontSizes map[font.Face]float64) *SVGCanvas {
+	return &SVGCanvas{
+		width:     width,
+		height:    height,
+		scale:     1,
+		fontSizes: fontSizes,
+		measure:   gg.NewContext(1, 1),
+		state:     svgState{color: color.Black},
+	}
+}
+
+func (sc *SVGCanvas) Width() int {
+	return sc.width
+}
+
+func (sc *SVGCanvas) Height() int {
+	return sc.height
+}
+
+func (sc *SVGCanvas) Push() {
+	s := sc.state
+	s.dash = append([]float64(nil), sc.state.dash...)
+	sc.stack = append(sc.stack, s)
+}
+
+func (sc *SVGCanvas) Pop() {
+	if len(sc.stack) == 0 {
+		return
+	}
+	sc.state = sc.stack[len(sc.stack)-1]
+	sc.stack = sc.stack[:len(sc.stack)-1]
+}
+
+func (sc *SVGCanvas) SetColor(c color.Color) {
+	sc.state.color = c
+}
+
+func (sc *SVGCanvas) SetRGB(r, g, b float64) {
+	sc.state.color = color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+}
+
+func (sc *SVGCanvas) SetDash(dashes ...float64) {
+	sc.state.dash = dashes
+}
+
+func (sc *SVGCanvas) SetFontFace(fontFace font.Face) {
+	sc.state.fontFace = fontFace
+	sc.measure.SetFontFace(fontFace)
+}
+
+func (sc *SVGCanvas) MeasureString(s string) (float64, float64) {
+	return sc.measure.MeasureString(s)
+}
+
+func (sc *SVGCanvas) WordWrap(s string, w float64) []string {
+	return sc.measure.WordWrap(s, w)
+}
+
+func (sc *SVGCanvas) MoveTo(x, y float64) {
+	fmt.Fprintf(&sc.path, "M%s %s ", svgNumber(x), svgNumber(y))
+}
+
+func (sc *SVGCanvas) LineTo(x, y float64) {
+	if sc.path.Len() == 0 {
+		sc.MoveTo(x, y)
+		return
+	}
+	fmt.Fprintf(&sc.path, "L%s %s ", svgNumber(x), svgNumber(y))
+}
+
+func (sc *SVGCanvas) ClosePath() {
+	sc.path.WriteString("Z ")
+}
+
+func (sc *SVGCanvas) DrawLine(x1, y1, x2, y2 float64) {
+	sc.MoveTo(x1, y1)
+	sc.LineTo(x2, y2)
+}
+
+func (sc *SVGCanvas) DrawRectangle(x, y, w, h float64) {
+	sc.MoveTo(x, y)
+	sc.LineTo(x+w, y)
+	sc.LineTo(x+w, y+h)
+	sc.LineTo(x, y+h)
+	sc.ClosePath()
+}
+
+func (sc *SVGCanvas) DrawEllipticalArc(x, y, rx, ry, angle1, angle2 float64) {
+	// same approximation as gg, straight segments along the arc.
+	const segments = 16
+	for i := 0; i <= segments; i++ {
+		a := angle1 + (angle2-angle1)*float64(i)/segments
+		px := x + rx*math.Cos(a)
+		py := y + ry*math.Sin(a)
+		if i == 0 {
+			sc.MoveTo(px, py)
+		} else {
+			sc.LineTo(px, py)
+		}
+	}
+}
+
+func (sc *SVGCanvas) Stroke() {
+	if sc.path.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(&sc.body, `<path d="%s" fill="none" stroke="%s"%s%s/>`+"\n",
+		strings.TrimSpace(sc.path.String()), svgColor(sc.state.color), svgOpacity("stroke-opacity", sc.state.color), sc.dashAttr())
+	sc.path.Reset()
+}
+
+func (sc *SVGCanvas) Fill() {
+	sc.FillPreserve()
+	sc.path.Reset()
+}
+
+func (sc *SVGCanvas) FillPreserve() {
+	if sc.path.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(&sc.body, `<path d="%s" fill="%s"%s stroke="none"/>`+"\n",
+		strings.TrimSpace(sc.path.String()), svgColor(sc.state.color), svgOpacity("fill-opacity", sc.state.color))
+}
+
+func (sc *SVGCanvas) DrawStringAnchored(s string, x, y, ax, ay float64) {
+	w, h := sc.MeasureString(s)
+	x -= ax * w
+	y += ay * h
+	size := sc.fontSizes[sc.state.fontFace]
+	// textLength keeps the width we laid out with even when the viewer substitutes the font.
+	fmt.Fprintf(&sc.body, `<text x="%s" y="%s" font-family="Go, sans-serif" font-size="%s" textLength="%s" lengthAdjust="spacingAndGlyphs" fill="%s">%s</text>`+"\n",
+		svgNumber(x), svgNumber(y), svgNumber(size), svgNumber(w), svgColor(sc.state.color), html.EscapeString(s))
+}
+
+func (sc *SVGCanvas) DrawStringWrapped(s string, x, y, ax, ay, width, lineSpacing float64, align gg.Align) {
+	// mirrors gg.Context.DrawStringWrapped
+	lines := sc.WordWrap(s, width)
+	_, fontHeight := sc.MeasureString(s)
+	h := float64(len(lines)) * fontHeight * lineSpacing
+	h -= (lineSpacing - 1) * fontHeight
+	x -= ax * width
+	y -= ay * h
+	switch align {
+	case gg.AlignLeft:
+		ax = 0
+	case gg.AlignCenter:
+		ax = 0.5
+		x += width / 2
+	case gg.AlignRight:
+		ax = 1
+		x += width
+	}
+	for _, line := range lines {
+		sc.DrawStringAnchored(line, x, y, ax, 1)
+		y += fontHeight * lineSpacing
+	}
+}
+
+func (sc *SVGCanvas) dashAttr() string {
+	if len(sc.state.dash) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, d := range sc.state.dash {
+		parts = append(parts, svgNumber(d))
+	}
+	return fmt.Sprintf(` stroke-dasharray="%s"`, strings.Join(parts, " "))
+}
+
+// Bytes returns the svg document.
+func (sc *SVGCanvas) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		scaled(sc.width, sc.scale), scaled(sc.height, sc.scale), sc.width, sc.height)
+	buf.Write(sc.body.Bytes())
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+func svgColor(c color.Color) string {
+	// RGBA() of an NRGBA is premultiplied again, the fields aren't.
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+func svgOpacity(attr string, c color.Color) string {
+	_, _, _, a := color.NRGBAModel.Convert(c).RGBA()
+	if a == 0xffff {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%s"`, attr, svgNumber(float64(a)/0xffff))
+}
+
+func svgNumber(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
@@ -0,0 +1,82 @@
+package sequence
+
+import "image/color"
+
+// Theme holds the colors a diagram is drawn with. Box colors set in the source win over
+// BoxFill, a nil Background keeps the png and svg transparent.
+type Theme struct {
+	Background      color.Color
+	ParticipantLine color.Color
+	ParticipantText color.Color
+	Lifeline        color.Color
+	MessageLine     color.Color
+	MessageText     color.Color
+	Arrow           color.Color
+	ProcessLine     color.Color
+	GroupLine       color.Color
+	GroupFill       color.Color
+	GroupText       color.Color
+	SeparatorLine   color.Color
+	SeparatorFill   color.Color
+	SeparatorText   color.Color
+	RefLine         color.Color
+	RefFill         color.Color
+	RefText         color.Color
+	BoxLine         color.Color
+	BoxFill         color.Color
+	BoxText         color.Color
+}
+
+// DefaultTheme is black on transparent with blue groups.
+func DefaultTheme() Theme {
+	return Theme{
+		ParticipantLine: color.Black,
+		ParticipantText: color.Black,
+		Lifeline:        color.Black,
+		MessageLine:     color.Black,
+		MessageText:     color.Black,
+		Arrow:           CONFIG_SEQUENCE_LINE_COLOR,
+		ProcessLine:     CONFIG_PROCESS_LINE_COLOR,
+		GroupLine:       CONFIG_GROUP_LINE_COLOR,
+		GroupFill:       CONFIG_GROUP_BG_FILL_COLOR,
+		GroupText:       CONFIG_GROUP_TEXT_COLOR,
+		SeparatorLine:   CONFIG_SEPARATOR_LINE_COLOR,
+		SeparatorFill:   CONFIG_SEPARATOR_BG_FILL_COLOR,
+		SeparatorText:   CONFIG_SEPARATOR_TEXT_COLOR,
+		RefLine:         CONFIG_REF_LINE_COLOR,
+		RefFill:         CONFIG_REF_BG_FILL_COLOR,
+		RefText:         CONFIG_REF_TEXT_COLOR,
+		BoxLine:         CONFIG_BOX_LINE_COLOR,
+		BoxFill:         CONFIG_BOX_BG_FILL_COLOR,
+		BoxText:         CONFIG_BOX_TEXT_COLOR,
+	}
+}
+
+// DarkTheme is light lines and text on a dark background.
+func DarkTheme() Theme {
+	light := color.RGBA{0xe0, 0xe0, 0xe0, 255}
+	accent := color.RGBA{0x6c, 0xa0, 0xff, 255}
+	fill := color.RGBA{0x30, 0x30, 0x30, 255}
+	return Theme{
+		Background:      color.RGBA{0x1e, 0x1e, 0x1e, 255},
+		ParticipantLine: light,
+		ParticipantText: light,
+		Lifeline:        accent,
+		MessageLine:     accent,
+		MessageText:     light,
+		Arrow:           accent,
+		ProcessLine:     light,
+		GroupLine:       accent,
+		GroupFill:       fill,
+		GroupText:       accent,
+		SeparatorLine:   color.RGBA{0x80, 0x80, 0x80, 255},
+		SeparatorFill:   fill,
+		SeparatorText:   light,
+		RefLine:         light,
+		RefFill:         fill,
+		RefText:         light,
+		BoxLine:         color.RGBA{0x60, 0x60, 0x60, 255},
+		BoxFill:         color.RGBA{0x28, 0x28, 0x28, 255},
+		BoxText:         light,
+	}
+}
@@ -0,0 +1,343 @@
+package sequence
+
+import (
+	"strings"
+)
+
+// TXT_MIN_GAP is the fewest characters between two lifelines of the text output.
+const TXT_MIN_GAP = 6
+
+// textCanvas draws the text output row by row, every row starts with the lifelines.
+type textCanvas struct {
+	// column of the lifeline of each participant.
+	centers []int
+	width   int
+	rows    [][]rune
+}
+
+// Text draws the diagram as plain text, participants are columns and messages arrows between
+// their lifelines:
+//
+//	A         B
+//	|         |
+//	|--hello->|
+//	|<...ok...|
+//
+// Dotted messages are drawn with dots, groups, separators and refs span the lifelines.
+// Activations, boxes and colors are left out.
+func (d *Diagram) Text() []byte {
+	tc := newTextCanvas(d)
+	tc.names(d)
+	tc.add(tc.lifelines())
+	for _, s := range d.sequences {
+		tc.sequence(d, s)
+	}
+	tc.add(tc.lifelines())
+	tc.names(d)
+
+	lines := make([]string, len(tc.rows))
+	for i, row := range tc.rows {
+		lines[i] = strings.TrimRight(string(row), " ")
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// textSize is the columns and rows of the text output, worked out without drawing it.
+func (d *Diagram) textSize() (int, int) {
+	tc := newTextCanvas(d)
+	columns := tc.width
+	// the names and lifelines above and below.
+	rows := 4
+	for _, s := range d.sequences {
+		// labels wider than the diagram widen their row.
+		label := 0
+		switch seq := s.(type) {
+		case *StartGroupMessage:
+			label = textWidth("+-- "+seq.name+" "+seq.message) + 1
+			rows++
+		case *EndGroupMessage:
+			rows++
+		case *Delay:
+			rows++
+			if len(seq.message) > 0 {
+				label = tc.centers[0] + textWidth(seq.message)
+				rows += 2
+			}
+		case *Divider:
+			label = textWidth(seq.message) + 2
+			rows++
+		case *Space:
+			if seq.height/CONFIG_MIN_PADDING_Y > 1 {
+				rows += seq.height / CONFIG_MIN_PADDING_Y
+			} else {
+				rows++
+			}
+		case *Ref:
+			rows += 3
+		default:
+			if !IsMessage(s) {
+				break
+			}
+			if s.PrimaryParticipant().name == s.SecondaryParticipant().name {
+				rows += 2
+			} else {
+				rows++
+			}
+		}
+		if label > columns {
+			columns = label
+		}
+	}
+	return columns, rows
+}
+
+// textWidth is the length of s in the text output, newlines of built diagrams become spaces.
+func textWidth(s string) int {
+	return len([]rune(s))
+}
+
+func oneLine(s string) string {
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// newTextCanvas places the lifelines far enough apart for the names and texts between them.
+func newTextCanvas(d *Diagram) *textCanvas {
+	n := len(d.participants)
+	// gaps[i] is the distance from lifeline i-1 to lifeline i.
+	gaps := make([]int, n)
+	for i := 1; i < n; i++ {
+		// names are two spaces apart.
+		gaps[i] = (textWidth(d.participants[i-1].name)+1)/2 + textWidth(d.participants[i].name)/2 + 2
+		if gaps[i] < TXT_MIN_GAP {
+			gaps[i] = TXT_MIN_GAP
+		}
+	}
+	widen := func(from int, to int, width int) {
+		if from > to {
+			from, to = to, from
+		}
+		if from < 0 || to >= n {
+			return
+		}
+		have := 0
+		for i := from + 1; i <= to; i++ {
+			have += gaps[i]
+		}
+		if have < width && to > from {
+			gaps[to] += width - have
+		}
+	}
+	// room right of the last lifeline, for self messages and refs over it.
+	right := 0
+	for _, s := range d.sequences {
+		switch seq := s.(type) {
+		case *Ref:
+			from, to := d.textSpan(seq)
+			width := textWidth(oneLine(seq.message)) + 6
+			if from == to {
+				widen(from-1, from, width/2+1)
+				widen(from, from+1, width/2+1)
+				if from == n-1 && width/2+1 > right {
+					right = width/2 + 1
+				}
+			} else {
+				widen(from, to, width)
+			}
+		default:
+			if !IsMessage(s) {
+				continue
+			}
+			from := d.participantMap[s.PrimaryParticipant().name]
+			to := d.participantMap[s.SecondaryParticipant().name]
+			width := textWidth(oneLine(s.Text())) + 5
+			if from != to {
+				widen(from, to, width)
+				continue
+			}
+			// self messages go right of the lifeline.
+			if from+1 < n {
+				widen(from, from+1, width+2)
+			} else if width+2 > right {
+				right = width + 2
+			}
+		}
+	}
+
+	tc := &textCanvas{centers: make([]int, n)}
+	if n == 0 {
+		return tc
+	}
+	tc.centers[0] = textWidth(d.participants[0].name) / 2
+	for i := 1; i < n; i++ {
+		tc.centers[i] = tc.centers[i-1] + gaps[i]
+	}
+	last := tc.centers[n-1]
+	tc.width = last + (textWidth(d.participants[n-1].name)+1)/2
+	if last+right+1 > tc.width {
+		tc.width = last + right + 1
+	}
+	return tc
+}
+
+// textSpan is the first and last participant of a ref in the order of the diagram.
+func (d *Diagram) textSpan(r *Ref) (int, int) {
+	from, to := -1, -1
+	for _, p := range r.participants {
+		idx := d.participantMap[p.name]
+		if from == -1 || idx < from {
+			from = idx
+		}
+		if idx > to {
+			to = idx
+		}
+	}
+	return from, to
+}
+
+func (tc *textCanvas) add(row []rune) {
+	tc.rows = append(tc.rows, row)
+}
+
+// lifelines is an empty row with the lifelines drawn with c.
+func (tc *textCanvas) lifelinesOf(c rune) []rune {
+	row := []rune(strings.Repeat(" ", tc.width))
+	for _, x := range tc.centers {
+		row[x] = c
+	}
+	return row
+}
+
+func (tc *textCanvas) lifelines() []rune {
+	return tc.lifelinesOf('|')
+}
+
+// put writes text into row from x on, the row grows when it is too short.
+func put(row []rune, x int, text string) []rune {
+	if x < 0 {
+		x = 0
+	}
+	for i, r := range []rune(text) {
+		for x+i >= len(row) {
+			row = append(row, ' ')
+		}
+		row[x+i] = r
+	}
+	return row
+}
+
+// centered writes text centered between the columns from and to.
+func centered(row []rune, from int, to int, text string) []rune {
+	return put(row, from+(to-from-textWidth(text)+1)/2, text)
+}
+
+func (tc *textCanvas) names(d *Diagram) {
+	row := []rune(strings.Repeat(" ", tc.width))
+	for i, p := range d.participants {
+		row = put(row, tc.centers[i]-textWidth(p.name)/2, p.name)
+	}
+	tc.add(row)
+}
+
+// frame is a row across the whole diagram starting with label.
+func (tc *textCanvas) frame(label string) []rune {
+	return put([]rune(strings.Repeat("-", tc.width)), 0, label)
+}
+
+func (tc *textCanvas) sequence(d *Diagram, s Sequence) {
+	switch seq := s.(type) {
+	case *StartGroupMessage:
+		tc.add(tc.frame("+-- " + strings.TrimSpace(seq.name+" "+oneLine(seq.message)) + " "))
+	case *EndGroupMessage:
+		tc.add(tc.frame("+"))
+	case *Delay:
+		// the text goes between dotted lifelines, it would cover them otherwise.
+		tc.add(tc.lifelinesOf(':'))
+		if len(seq.message) > 0 {
+			row := []rune(strings.Repeat(" ", tc.width))
+			tc.add(centered(row, tc.centers[0], tc.centers[len(tc.centers)-1], oneLine(seq.message)))
+			tc.add(tc.lifelinesOf(':'))
+		}
+	case *Divider:
+		row := []rune(strings.Repeat("=", tc.width))
+		if len(seq.message) > 0 {
+			row = centered(row, 0, tc.width, " "+oneLine(seq.message)+" ")
+		}
+		tc.add(row)
+	case *Space:
+		rows := seq.height / CONFIG_MIN_PADDING_Y
+		if rows < 1 {
+			rows = 1
+		}
+		for i := 0; i < rows; i++ {
+			tc.add(tc.lifelines())
+		}
+	case *Ref:
+		tc.ref(d, seq)
+	default:
+		if IsMessage(s) {
+			tc.message(d, s)
+		}
+	}
+}
+
+func (tc *textCanvas) message(d *Diagram, s Sequence) {
+	line := '-'
+	switch s.Type() {
+	case ST_DOTTED, ST_START_DOTTED_PROCESS, ST_END_DOTTED_PROCESS:
+		line = '.'
+	}
+	text := oneLine(s.Text())
+	from := tc.centers[d.participantMap[s.PrimaryParticipant().name]]
+	to := tc.centers[d.participantMap[s.SecondaryParticipant().name]]
+
+	if from == to {
+		out := tc.lifelines()
+		out = put(out, from+1, string([]rune{line, line, '.'})+" "+text)
+		back := tc.lifelines()
+		back = put(back, from+1, string([]rune{'<', line, '\''}))
+		tc.add(out)
+		tc.add(back)
+		return
+	}
+
+	row := tc.lifelines()
+	left, right := from, to
+	if left > right {
+		left, right = right, left
+	}
+	for x := left + 1; x < right; x++ {
+		row[x] = line
+	}
+	if to > from {
+		row[to-1] = '>'
+	} else {
+		row[to+1] = '<'
+	}
+	if len(text) > 0 {
+		// between the arrow heads of either side.
+		row = centered(row, left+2, right-1, text)
+	}
+	tc.add(row)
+}
+
+func (tc *textCanvas) ref(d *Diagram, r *Ref) {
+	from, to := d.textSpan(r)
+	text := oneLine(r.message)
+	left, right := tc.centers[from]-2, tc.centers[to]+2
+	if right-left < textWidth(text)+4 {
+		middle := (left + right) / 2
+		left = middle - (textWidth(text)+4)/2
+		right = left + textWidth(text) + 4
+	}
+	if left < 0 {
+		left = 0
+	}
+	border := "+" + strings.Repeat("-", right-left-1) + "+"
+	top := put(tc.lifelines(), left, border)
+	top = put(top, left+1, "ref")
+	body := put(tc.lifelines(), left, "|"+strings.Repeat(" ", right-left-1)+"|")
+	body = centered(body, left+1, right, text)
+	tc.add(top)
+	tc.add(body)
+	tc.add(put(tc.lifelines(), left, border))
+}
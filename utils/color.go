@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+var namedColors = map[string]color.RGBA{
+	"white":       {0xff, 0xff, 0xff, 0xff},
+	"black":       {0x00, 0x00, 0x00, 0xff},
+	"gray":        {0x80, 0x80, 0x80, 0xff},
+	"grey":        {0x80, 0x80, 0x80, 0xff},
+	"lightgray":   {0xd3, 0xd3, 0xd3, 0xff},
+	"lightgrey":   {0xd3, 0xd3, 0xd3, 0xff},
+	"red":         {0xff, 0x00, 0x00, 0xff},
+	"pink":        {0xff, 0xc0, 0xcb, 0xff},
+	"orange":      {0xff, 0xa5, 0x00, 0xff},
+	"yellow":      {0xff, 0xff, 0x00, 0xff},
+	"lightyellow": {0xff, 0xff, 0xe0, 0xff},
+	"green":       {0x00, 0x80, 0x00, 0xff},
+	"lightgreen":  {0x90, 0xee, 0x90, 0xff},
+	"blue":        {0x00, 0x00, 0xff, 0xff},
+	"lightblue":   {0xad, 0xd8, 0xe6, 0xff},
+	"skyblue":     {0x87, 0xce, 0xeb, 0xff},
+	"purple":      {0x80, 0x00, 0x80, 0xff},
+	"lavender":    {0xe6, 0xe6, 0xfa, 0xff},
+	"beige":       {0xf5, 0xf5, 0xdc, 0xff},
+	"wheat":       {0xf5, 0xde, 0xb3, 0xff},
+}
+
+// ParseColor reads a color written as #rgb, #rrggbb or #name ( the leading # is optional ).
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("Unknown color %s", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("Unknown color %s", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
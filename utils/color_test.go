@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	c, err := ParseColor("#lightblue")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{0xad, 0xd8, 0xe6, 0xff}, c)
+
+	c, err = ParseColor("#FF8000")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{0xff, 0x80, 0x00, 0xff}, c)
+
+	c, err = ParseColor("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{0xaa, 0xbb, 0xcc, 0xff}, c)
+
+	_, err = ParseColor("#notacolor")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package sequence
+
+import "context"
+
+// ValidationResult is what the parser and layout found in a source, without rendering it.
+type ValidationResult struct {
+	Valid        bool         `json:"valid"`
+	Participants []string     `json:"participants"`
+	Messages     int          `json:"messages"`
+	Diagnostics  []Diagnostic `json:"diagnostics"`
+}
+
+// Validate parses and lays out the source like CreateDiagramWithConfig but stops before an
+// image is drawn. Participants and messages found before an error are still counted.
+func Validate(source string, cfg Config) (ValidationResult, error) {
+	return ValidateContext(context.Background(), source, cfg, Limits{})
+}
+
+// ValidateContext validates within limits, going over one is an error diagnostic. Once ctx is
+// done its error is returned.
+func ValidateContext(ctx context.Context, source string, cfg Config, limits Limits) (ValidationResult, error) {
+	result := ValidationResult{Participants: []string{}, Diagnostics: []Diagnostic{}}
+	r, err := NewRenderer(WithConfig(cfg), WithLimits(limits))
+	if err != nil {
+		return result, err
+	}
+	d := r.NewDiagram()
+	d.ctx = ctx
+
+	err = d.Parse(source)
+	if err == nil {
+		err = d.Layout()
+	}
+	if err != nil && err == ctx.Err() {
+		return result, err
+	}
+	for _, p := range d.participants {
+		result.Participants = append(result.Participants, p.name)
+	}
+	for _, s := range d.sequences {
+		if IsMessage(s) {
+			result.Messages++
+		}
+	}
+	result.Diagnostics = append(result.Diagnostics, d.Warnings()...)
+	if err != nil {
+		var dg Diagnostic
+		switch e := err.(type) {
+		case Diagnostic:
+			dg = e
+		case LimitError:
+			dg = Diagnostic{Severity: SEVERITY_ERROR, Line: e.Line, Column: d.column(e.Line), Message: e.message()}
+		default:
+			dg = Diagnostic{Severity: SEVERITY_ERROR, Message: err.Error()}
+		}
+		result.Diagnostics = append(result.Diagnostics, dg)
+	}
+	result.Valid = err == nil
+	return result, nil
+}
+
+// IsMessage tells arrows between participants apart from groups, dividers and the like.
+func IsMessage(s Sequence) bool {
+	switch s.Type() {
+	case ST_SOLID, ST_DOTTED, ST_START_PROCESS, ST_END_PROCESS, ST_START_DOTTED_PROCESS, ST_END_DOTTED_PROCESS:
+		return true
+	}
+	return false
+}